@@ -12,6 +12,9 @@ import (
 func main() {
 	r := chi.NewRouter()
 	routes.SetupRoutes()
+	if err := odata.Validate(); err != nil {
+		log.Fatal("Invalid entity registry: ", err)
+	}
 	odata.RegisterRoutes(r)
 
 	log.Println("Routes registered")
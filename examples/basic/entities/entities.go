@@ -7,7 +7,7 @@ type Products struct {
 	Price        float64     `json:"Price"`
 	Category_ID  string     `json:"Category_ID" odata:"ref:Categories"`
 	Category     *Categories `json:"Category,omitempty" odata:"expand:Category"`
-	Supplier_ID  string      `json:"Supplier_ID" oSuppliers"`
+	Supplier_ID  string      `json:"Supplier_ID" odata:"ref:Suppliers"`
     Supplier     *Suppliers  `json:"Supplier,omitempty" odata:"expand:Supplier"`
 }
 
@@ -143,7 +143,12 @@ func SetupRoutes() {
     productHandler := ProductExpandHandler{}
     odata.RegisterEntity(entities.Products{}, odata.EntityHandler{
         GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {
-            result := odata.ApplySkipTop(products, r.URL.Query().Get("$skip"), r.URL.Query().Get("$top"))
+            filtered, err := odata.ApplyFilter(products, r.URL.RawQuery)
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            result := odata.ApplySkipTop(filtered, r.URL.Query().Get("$skip"), r.URL.Query().Get("$top"))
             result = odata.ApplyExpand(result, r.URL.RawQuery, productHandler)
             result = odata.ApplySelect(result, r.URL.RawQuery)
             odata.CreateODataResponse(w, "Products", result)
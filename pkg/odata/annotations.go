@@ -0,0 +1,225 @@
+package odata
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Values of the odata.metadata format parameter, which controls how much
+// control information is written to JSON payloads.
+const (
+	MetadataNone    = "none"
+	MetadataMinimal = "minimal"
+	MetadataFull    = "full"
+)
+
+// InstanceAnnotator can be implemented by entities to carry custom instance
+// annotations. Keys are annotation terms such as "com.example.flag" for the
+// entity, or "Name@com.example.flag" for its Name property.
+type InstanceAnnotator interface {
+	InstanceAnnotations() map[string]interface{}
+}
+
+// Annotate returns a copy of the entity with the instance annotation term,
+// e.g. "com.example.flag", added ahead of its properties.
+func (of OrderedFields) Annotate(term string, value interface{}) OrderedFields {
+	key := "@" + strings.TrimPrefix(term, "@")
+	insertAt := 0
+	for insertAt < len(of.Fields) && strings.HasPrefix(of.Fields[insertAt].Key, "@") {
+		insertAt++
+	}
+	return of.insertField(insertAt, key, value)
+}
+
+// AnnotateProperty returns a copy of the entity with the instance annotation
+// term added to property, ahead of the property itself.
+func (of OrderedFields) AnnotateProperty(property, term string, value interface{}) OrderedFields {
+	key := property + "@" + strings.TrimPrefix(term, "@")
+	insertAt := len(of.Fields)
+	for i, field := range of.Fields {
+		if field.Key == property {
+			insertAt = i
+			break
+		}
+	}
+	return of.insertField(insertAt, key, value)
+}
+
+func (of OrderedFields) insertField(index int, key string, value interface{}) OrderedFields {
+	fields := make([]struct{Key string; Value interface{}}, 0, len(of.Fields)+1)
+	fields = append(fields, of.Fields[:index]...)
+	fields = append(fields, struct{Key string; Value interface{}}{key, value})
+	fields = append(fields, of.Fields[index:]...)
+	return OrderedFields{EntityName: of.EntityName, Fields: fields}
+}
+
+// addInstanceAnnotations adds the annotations of an InstanceAnnotator to the
+// serialized entity.
+func addInstanceAnnotations(result OrderedFields, entity interface{}) OrderedFields {
+	annotator, ok := entity.(InstanceAnnotator)
+	if !ok {
+		return result
+	}
+	annotations := annotator.InstanceAnnotations()
+	terms := make([]string, 0, len(annotations))
+	for term := range annotations {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	for _, term := range terms {
+		if property, propertyTerm, ok := strings.Cut(strings.TrimPrefix(term, "@"), "@"); ok {
+			result = result.AnnotateProperty(property, propertyTerm, annotations[term])
+		} else {
+			result = result.Annotate(term, annotations[term])
+		}
+	}
+	return result
+}
+
+// metadataLevel returns the odata.metadata format parameter requested with
+// $format or the Accept header, defaulting to minimal.
+func metadataLevel(r *http.Request) string {
+	if level := formatMetadataParameter(formatOption(r)); level != "" {
+		return level
+	}
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		if level := formatMetadataParameter(mediaRange); level != "" {
+			return level
+		}
+	}
+	return MetadataMinimal
+}
+
+// formatOption returns the $format query option of r.
+func formatOption(r *http.Request) string {
+	// $format values contain ';', which url.ParseQuery rejects
+	for _, option := range strings.Split(r.URL.RawQuery, "&") {
+		if format, ok := strings.CutPrefix(option, "$format="); ok {
+			if format, err := url.QueryUnescape(format); err == nil {
+				return format
+			}
+		}
+	}
+	return ""
+}
+
+// formatMetadataParameter extracts odata.metadata from a media type such as
+// application/json;odata.metadata=full.
+func formatMetadataParameter(mediaType string) string {
+	for _, parameter := range strings.Split(mediaType, ";")[1:] {
+		name, value, _ := strings.Cut(strings.TrimSpace(parameter), "=")
+		name = strings.ToLower(name)
+		if name != "odata.metadata" && name != "metadata" {
+			continue
+		}
+		switch value = strings.ToLower(value); value {
+		case MetadataNone, MetadataMinimal, MetadataFull:
+			return value
+		default:
+			log.Printf("Ignoring unknown odata.metadata value: %s", value)
+		}
+	}
+	return ""
+}
+
+// applyMetadataLevel adds or removes the control information of v for the
+// odata.metadata level requested for the response.
+func applyMetadataLevel(w http.ResponseWriter, v interface{}) interface{} {
+	pw := responsePreferences(w)
+	if pw == nil {
+		return v
+	}
+	switch pw.metadata {
+	case MetadataNone:
+		return transformEntities(v, removeControlInformation)
+	case MetadataFull:
+		return transformEntities(v, addFullControlInformation)
+	}
+	return v
+}
+
+// transformEntities applies transform to every OrderedFields in v,
+// innermost first.
+func transformEntities(v interface{}, transform func(OrderedFields) OrderedFields) interface{} {
+	switch value := v.(type) {
+	case OrderedFields:
+		result := OrderedFields{EntityName: value.EntityName, Fields: make([]struct{Key string; Value interface{}}, len(value.Fields))}
+		for i, field := range value.Fields {
+			result.Fields[i] = struct{Key string; Value interface{}}{field.Key, transformEntities(field.Value, transform)}
+		}
+		return transform(result)
+	case []OrderedFields:
+		result := make([]OrderedFields, len(value))
+		for i, entity := range value {
+			result[i] = transformEntities(entity, transform).(OrderedFields)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, entity := range value {
+			result[i] = transformEntities(entity, transform)
+		}
+		return result
+	}
+	return v
+}
+
+// removeControlInformation drops the control information odata.metadata=none
+// leaves out. Paging and delta links and entity references are kept.
+func removeControlInformation(entity OrderedFields) OrderedFields {
+	result := OrderedFields{EntityName: entity.EntityName, Fields: make([]struct{Key string; Value interface{}}, 0, len(entity.Fields))}
+	for _, field := range entity.Fields {
+		_, term, _ := strings.Cut(field.Key, "@")
+		switch term {
+		case "odata.id", "odata.count", "odata.nextLink", "odata.deltaLink":
+		default:
+			if strings.HasPrefix(term, "odata.") {
+				continue
+			}
+		}
+		result.Fields = append(result.Fields, field)
+	}
+	return result
+}
+
+// addFullControlInformation adds the control information odata.metadata=full
+// requires to an entity: its id, edit link and type, and the navigation and
+// association links of its navigation properties.
+func addFullControlInformation(entity OrderedFields) OrderedFields {
+	if _, ok := lookupEntityType(entity.EntityName); !ok {
+		return entity
+	}
+	for _, field := range entity.Fields {
+		switch field.Key {
+		case "@odata.id", "@id", "@removed":
+			// Entity references and removed entities carry no other control
+			// information
+			return entity
+		}
+	}
+	reference := entityReference(entity)
+	if reference == "" {
+		return entity
+	}
+
+	result := entity.
+		Annotate("odata.type", "#"+schemaNamespace+"."+entity.EntityName).
+		Annotate("odata.id", reference).
+		Annotate("odata.editLink", reference)
+
+	relationshipNames := make([]string, 0, len(entityRelationships[entity.EntityName]))
+	for relationshipName := range entityRelationships[entity.EntityName] {
+		relationshipNames = append(relationshipNames, relationshipName)
+	}
+	sort.Strings(relationshipNames)
+	for _, relationshipName := range relationshipNames {
+		result = result.
+			AnnotateProperty(relationshipName, "odata.navigationLink", reference+"/"+relationshipName).
+			AnnotateProperty(relationshipName, "odata.associationLink", reference+"/"+relationshipName+"/$ref")
+	}
+	return result
+}
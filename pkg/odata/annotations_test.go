@@ -0,0 +1,120 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestTasks struct {
+	ID    string `json:"ID" odata:"key"`
+	Title string `json:"Title"`
+}
+
+func (t TestTasks) EntityName() string {
+	return "Tasks"
+}
+
+func (t TestTasks) GetRelationships() map[string]string {
+	return map[string]string{}
+}
+
+func (t TestTasks) InstanceAnnotations() map[string]interface{} {
+	return map[string]interface{}{
+		"com.example.flag":       true,
+		"Title@com.example.hint": "short",
+	}
+}
+
+func fieldKeys(entity OrderedFields) []string {
+	keys := make([]string, len(entity.Fields))
+	for i, field := range entity.Fields {
+		keys[i] = field.Key
+	}
+	return keys
+}
+
+func TestInstanceAnnotations(t *testing.T) {
+	entity := EntityToOrderedFields(TestTasks{ID: "1", Title: "Write docs"}, "")
+	assert.Equal(t, []string{"@com.example.flag", "ID", "Title@com.example.hint", "Title"}, fieldKeys(entity))
+
+	annotated := entity.Annotate("com.example.priority", 1).AnnotateProperty("ID", "@com.example.readonly", true)
+	assert.Equal(t, []string{"@com.example.flag", "@com.example.priority", "ID@com.example.readonly", "ID", "Title@com.example.hint", "Title"}, fieldKeys(annotated))
+	assert.Len(t, entity.Fields, 4)
+}
+
+func TestMetadataLevel(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## annotations_test - TestMetadataLevel")
+	fmt.Println("")
+	r := setupTestRouter()
+	RegisterEntity(TestTasks{}, EntityHandler{
+		GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {
+			CreateODataResponse(w, "Tasks", []TestTasks{{ID: "1", Title: "Write docs"}})
+		},
+	})
+
+	get := func(url, accept string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req, _ := http.NewRequest("GET", url, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return w, response
+	}
+
+	t.Run("Full metadata", func(t *testing.T) {
+		w, product := get("/odata/v4/Products/1?$format=application/json;odata.metadata=full", "")
+		assert.Equal(t, "application/json;odata.metadata=full", w.Header().Get("Content-Type"))
+		assert.Equal(t, "/odata/v4/$metadata#Products/$entity", product["@odata.context"])
+		assert.Equal(t, "#CatalogService.Products", product["@odata.type"])
+		assert.Equal(t, "Products('1')", product["@odata.id"])
+		assert.Equal(t, "Products('1')", product["@odata.editLink"])
+		assert.Equal(t, "Products('1')/Category", product["Category@odata.navigationLink"])
+		assert.Equal(t, "Products('1')/Category/$ref", product["Category@odata.associationLink"])
+		assert.Equal(t, "Products('1')/Supplier", product["Supplier@odata.navigationLink"])
+	})
+
+	t.Run("Full metadata for expanded entities", func(t *testing.T) {
+		_, product := get("/odata/v4/Products/1?$expand=Category", "application/json;odata.metadata=full")
+		category := product["Category"].(map[string]interface{})
+		assert.Equal(t, "#CatalogService.Categories", category["@odata.type"])
+		assert.Equal(t, "Categories('"+fmt.Sprint(category["ID"])+"')", category["@odata.id"])
+	})
+
+	t.Run("No metadata", func(t *testing.T) {
+		w, response := get("/odata/v4/Products?$format=json;odata.metadata=none", "")
+		assert.Equal(t, "application/json;odata.metadata=none", w.Header().Get("Content-Type"))
+		assert.NotContains(t, response, "@odata.context")
+		assert.NotEmpty(t, response["value"])
+	})
+
+	t.Run("Custom annotations with each level", func(t *testing.T) {
+		_, response := get("/odata/v4/Tasks", "application/json;odata.metadata=none")
+		task := response["value"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, true, task["@com.example.flag"])
+		assert.Equal(t, "short", task["Title@com.example.hint"])
+
+		_, response = get("/odata/v4/Tasks", "application/json;odata.metadata=full")
+		task = response["value"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, true, task["@com.example.flag"])
+		assert.Equal(t, "Tasks('1')", task["@odata.id"])
+	})
+
+	t.Run("Minimal metadata by default", func(t *testing.T) {
+		w, product := get("/odata/v4/Products/1", "")
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.NotContains(t, product, "@odata.id")
+		assert.NotContains(t, product, "Category@odata.navigationLink")
+	})
+}
@@ -0,0 +1,318 @@
+package odata
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AsyncResponse is the response recorded for a request processed
+// asynchronously.
+type AsyncResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// AsyncJob is the state of a request processed asynchronously. Response is
+// nil while the request is still running.
+type AsyncJob struct {
+	ID       string
+	Response *AsyncResponse
+}
+
+// AsyncJobStore persists asynchronous jobs for the status monitor. Replace
+// AsyncJobs to keep them somewhere other than in memory.
+type AsyncJobStore interface {
+	SaveJob(job AsyncJob) error
+	LoadJob(id string) (AsyncJob, bool, error)
+	DeleteJob(id string) error
+}
+
+// AsyncJobs is the store used for requests sent with Prefer: respond-async.
+// Setting it to nil disables asynchronous processing.
+var AsyncJobs AsyncJobStore = NewMemoryAsyncJobStore()
+
+// MemoryAsyncJobStore is an AsyncJobStore that keeps jobs in memory.
+// Finished jobs are discarded MaxAge after they finish, or once the client
+// deletes them through the status monitor; a MaxAge of 0 keeps them until
+// then.
+type MemoryAsyncJobStore struct {
+	MaxAge time.Duration
+
+	mu       sync.RWMutex
+	jobs     map[string]AsyncJob
+	finished map[string]time.Time
+}
+
+// NewMemoryAsyncJobStore returns a MemoryAsyncJobStore that keeps finished
+// jobs for an hour.
+func NewMemoryAsyncJobStore() *MemoryAsyncJobStore {
+	return &MemoryAsyncJobStore{
+		MaxAge:   time.Hour,
+		jobs:     make(map[string]AsyncJob),
+		finished: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryAsyncJobStore) SaveJob(job AsyncJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictExpired()
+	s.jobs[job.ID] = job
+	if job.Response != nil {
+		s.finished[job.ID] = time.Now()
+	}
+	return nil
+}
+
+func (s *MemoryAsyncJobStore) LoadJob(id string) (AsyncJob, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if ok && s.expired(id) {
+		return AsyncJob{}, false, nil
+	}
+	return job, ok, nil
+}
+
+func (s *MemoryAsyncJobStore) DeleteJob(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	delete(s.finished, id)
+	return nil
+}
+
+// expired reports whether the job id finished more than MaxAge ago.
+func (s *MemoryAsyncJobStore) expired(id string) bool {
+	finished, ok := s.finished[id]
+	return ok && s.MaxAge > 0 && time.Since(finished) > s.MaxAge
+}
+
+// evictExpired discards the expired jobs. s.mu must be held for writing.
+func (s *MemoryAsyncJobStore) evictExpired() {
+	for id := range s.finished {
+		if s.expired(id) {
+			delete(s.jobs, id)
+			delete(s.finished, id)
+		}
+	}
+}
+
+// runningJobs holds the cancel functions of the jobs running in this process.
+var (
+	runningJobsMu sync.Mutex
+	runningJobs   = make(map[string]context.CancelFunc)
+)
+
+// withAsync runs requests sent with Prefer: respond-async in the background
+// and answers with 202 Accepted and the URL of their status monitor.
+func withAsync(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefs := RequestPreferences(r)
+		store := AsyncJobs
+		if !prefs.RespondAsync || store == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The request body is closed once this handler returns, so the job
+		// reads from a copy
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		id, err := newAsyncJobID()
+		if err == nil {
+			err = store.SaveJob(AsyncJob{ID: id})
+		}
+		if err != nil {
+			http.Error(w, "Failed to start asynchronous request: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The job outlives the request, so it must not be canceled with it
+		ctx, cancel := context.WithCancel(detachRouteContext(context.WithoutCancel(r.Context())))
+		runningJobsMu.Lock()
+		runningJobs[id] = cancel
+		runningJobsMu.Unlock()
+
+		job := r.Clone(ctx)
+		job.Body = io.NopCloser(bytes.NewReader(body))
+		go runAsyncJob(store, id, next, job, prefs)
+
+		if pw := responsePreferences(w); pw != nil {
+			pw.apply("respond-async")
+		}
+		w.Header().Set("Location", "/odata/v4/$async/"+id)
+		w.Header().Set("OData-Version", "4.0")
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func runAsyncJob(store AsyncJobStore, id string, next http.Handler, r *http.Request, prefs Preferences) {
+	recorder := &asyncResponseWriter{header: make(http.Header)}
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Asynchronous request %s panicked: %v", id, p)
+			recorder = &asyncResponseWriter{header: make(http.Header), status: http.StatusInternalServerError}
+			recorder.body.WriteString("Internal server error\n")
+		}
+
+		runningJobsMu.Lock()
+		defer runningJobsMu.Unlock()
+		cancel, running := runningJobs[id]
+		if !running {
+			// Canceled through the status monitor
+			return
+		}
+		delete(runningJobs, id)
+		defer cancel()
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		job := AsyncJob{ID: id, Response: &AsyncResponse{
+			StatusCode: recorder.status,
+			Header:     recorder.header,
+			Body:       recorder.body.Bytes(),
+		}}
+		if err := store.SaveJob(job); err != nil {
+			log.Printf("Failed to save asynchronous request %s: %v", id, err)
+		}
+	}()
+
+	next.ServeHTTP(newPreferenceResponseWriter(recorder, r, prefs), r)
+}
+
+// detachRouteContext copies the chi routing context of ctx, which the router
+// recycles once the request that owns it is answered.
+func detachRouteContext(ctx context.Context) context.Context {
+	rctx := chi.RouteContext(ctx)
+	if rctx == nil {
+		return ctx
+	}
+	clone := chi.NewRouteContext()
+	clone.Routes = rctx.Routes
+	clone.RoutePath = rctx.RoutePath
+	clone.RouteMethod = rctx.RouteMethod
+	clone.RoutePatterns = append([]string(nil), rctx.RoutePatterns...)
+	clone.URLParams.Keys = append([]string(nil), rctx.URLParams.Keys...)
+	clone.URLParams.Values = append([]string(nil), rctx.URLParams.Values...)
+	return context.WithValue(ctx, chi.RouteCtxKey, clone)
+}
+
+func newAsyncJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// asyncResponseWriter records the response of an asynchronous request.
+type asyncResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *asyncResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *asyncResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *asyncResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// handleGetAsyncStatus serves the status monitor of an asynchronous request:
+// 202 while it is running and the embedded final response once it is done.
+func handleGetAsyncStatus(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	store := AsyncJobs
+	if store == nil {
+		http.Error(w, "Asynchronous requests not supported", http.StatusNotFound)
+		return
+	}
+
+	job, found, err := store.LoadJob(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Asynchronous request not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("OData-Version", "4.0")
+	if job.Response == nil {
+		w.Header().Set("Location", r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	response := job.Response
+	w.Header().Set("Content-Type", "application/http")
+	w.Header().Set("Content-Transfer-Encoding", "binary")
+	w.Header().Set("AsyncResult", strconv.Itoa(response.StatusCode))
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", response.StatusCode, http.StatusText(response.StatusCode))
+	response.Header.Write(w)
+	fmt.Fprint(w, "\r\n")
+	w.Write(response.Body)
+}
+
+// handleDeleteAsyncStatus cancels a running asynchronous request, or discards
+// the response of a finished one.
+func handleDeleteAsyncStatus(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	store := AsyncJobs
+	if store == nil {
+		http.Error(w, "Asynchronous requests not supported", http.StatusNotFound)
+		return
+	}
+
+	if _, found, err := store.LoadJob(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !found {
+		http.Error(w, "Asynchronous request not found", http.StatusNotFound)
+		return
+	}
+
+	runningJobsMu.Lock()
+	if cancel, running := runningJobs[id]; running {
+		cancel()
+		delete(runningJobs, id)
+	}
+	runningJobsMu.Unlock()
+
+	if err := store.DeleteJob(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,150 @@
+package odata
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestReports struct {
+	ID    string `json:"ID" odata:"key"`
+	Total int    `json:"Total"`
+}
+
+func (r TestReports) EntityName() string {
+	return "Reports"
+}
+
+func (r TestReports) GetRelationships() map[string]string {
+	return map[string]string{}
+}
+
+func sendAsync(r *chi.Mux, method, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Prefer", "respond-async")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// waitForAsync polls the status monitor until the request is done.
+func waitForAsync(t *testing.T, r *chi.Mux, location string) *httptest.ResponseRecorder {
+	for i := 0; i < 100; i++ {
+		w := sendEntity(r, "GET", location, "")
+		if w.Code != http.StatusAccepted {
+			return w
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("asynchronous request %s did not finish", location)
+	return nil
+}
+
+func TestAsyncRequest(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## async_test - TestAsyncRequest")
+	fmt.Println("")
+	r := setupOrderRouter()
+
+	release := make(chan struct{})
+	canceled := make(chan struct{})
+	RegisterEntity(TestReports{}, EntityHandler{
+		GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+				CreateODataResponse(w, "Reports", []TestReports{{ID: "nightly", Total: 42}})
+			case <-r.Context().Done():
+				close(canceled)
+			}
+		},
+	})
+
+	t.Run("Status monitor for a running request", func(t *testing.T) {
+		w := sendAsync(r, "GET", "/odata/v4/Reports", "")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, "respond-async", w.Header().Get("Preference-Applied"))
+		location := w.Header().Get("Location")
+		assert.True(t, strings.HasPrefix(location, "/odata/v4/$async/"))
+
+		w = sendEntity(r, "GET", location, "")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		close(release)
+		w = waitForAsync(t, r, location)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/http", w.Header().Get("Content-Type"))
+		assert.Equal(t, "200", w.Header().Get("AsyncResult"))
+		assert.True(t, strings.HasPrefix(w.Body.String(), "HTTP/1.1 200 OK\r\n"))
+		assert.Contains(t, w.Body.String(), "Content-Type: application/json\r\n")
+		assert.Contains(t, w.Body.String(), `"Total": 42`)
+
+		w = sendEntity(r, "DELETE", location, "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		w = sendEntity(r, "GET", location, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Asynchronous create reads the request body", func(t *testing.T) {
+		resetTestOrders()
+		w := sendAsync(r, "POST", "/odata/v4/Orders", `{"ID":"O2","Customer":"Initech"}`)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		w = waitForAsync(t, r, w.Header().Get("Location"))
+		assert.Equal(t, "201", w.Header().Get("AsyncResult"))
+		assert.Contains(t, w.Body.String(), "Location: Orders('O2')\r\n")
+		assert.Len(t, testOrders, 2)
+	})
+
+	t.Run("Cancel a running request", func(t *testing.T) {
+		release = make(chan struct{})
+		w := sendAsync(r, "GET", "/odata/v4/Reports", "")
+		location := w.Header().Get("Location")
+
+		w = sendEntity(r, "DELETE", location, "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("asynchronous request was not canceled")
+		}
+
+		w = sendEntity(r, "GET", location, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Unknown status monitor", func(t *testing.T) {
+		w := sendEntity(r, "GET", "/odata/v4/$async/unknown", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = sendEntity(r, "DELETE", "/odata/v4/$async/unknown", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestMemoryAsyncJobStore(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## async_test - TestMemoryAsyncJobStore")
+	fmt.Println("")
+	store := NewMemoryAsyncJobStore()
+	store.MaxAge = 10 * time.Millisecond
+
+	store.SaveJob(AsyncJob{ID: "running"})
+	store.SaveJob(AsyncJob{ID: "done", Response: &AsyncResponse{StatusCode: http.StatusOK}})
+	_, found, err := store.LoadJob("done")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	time.Sleep(20 * time.Millisecond)
+	_, found, _ = store.LoadJob("done")
+	assert.False(t, found, "finished jobs expire after MaxAge")
+	_, found, _ = store.LoadJob("running")
+	assert.True(t, found, "running jobs do not expire")
+
+	store.SaveJob(AsyncJob{ID: "next"})
+	assert.NotContains(t, store.jobs, "done")
+}
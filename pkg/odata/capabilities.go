@@ -0,0 +1,71 @@
+package odata
+
+import "reflect"
+
+// capabilityAnnotations returns the Capabilities restrictions of an entity
+// set, derived from the callbacks its handler implements and the nofilter,
+// nosort and noexpand tags of its properties. Only restrictions are emitted;
+// clients assume that anything not annotated is supported. Terms registered
+// for the entity set with RegisterAnnotations take precedence and are left
+// out.
+func capabilityAnnotations(entityType Entity, handler EntityHandler) []*EdmAnnotation {
+	var annotations []*EdmAnnotation
+	if handler.CreateEntityHandler == nil && handler.EntityCreator == nil {
+		annotations = append(annotations, capabilityRestrictions("Capabilities.InsertRestrictions", "Insertable", false, "", nil))
+	}
+	if handler.UpdateEntityHandler == nil && (handler.EntityUpdater == nil || handler.EntityReader == nil) {
+		annotations = append(annotations, capabilityRestrictions("Capabilities.UpdateRestrictions", "Updatable", false, "", nil))
+	}
+	if handler.DeleteEntityHandler == nil && handler.EntityDeleter == nil {
+		annotations = append(annotations, capabilityRestrictions("Capabilities.DeleteRestrictions", "Deletable", false, "", nil))
+	}
+
+	model := modelOf(reflect.TypeOf(entityType))
+	nonFilterable, nonSortable, nonExpandable := &EdmCollection{}, &EdmCollection{}, &EdmCollection{}
+	hasNavigation := false
+	for _, property := range model.Properties {
+		if property.Navigation {
+			hasNavigation = true
+			if property.tags.NoExpand {
+				nonExpandable.NavigationPropertyPaths = append(nonExpandable.NavigationPropertyPaths, property.Name)
+			}
+			continue
+		}
+		if property.tags.NoFilter {
+			nonFilterable.PropertyPaths = append(nonFilterable.PropertyPaths, property.Name)
+		}
+		if property.tags.NoSort {
+			nonSortable.PropertyPaths = append(nonSortable.PropertyPaths, property.Name)
+		}
+	}
+
+	// Query options on the collection are applied by its GetEntityHandler
+	if handler.GetEntityHandler == nil {
+		annotations = append(annotations,
+			capabilityRestrictions("Capabilities.CountRestrictions", "Countable", false, "", nil),
+			capabilityRestrictions("Capabilities.FilterRestrictions", "Filterable", false, "", nil),
+			capabilityRestrictions("Capabilities.SortRestrictions", "Sortable", false, "", nil),
+		)
+	} else {
+		if len(nonFilterable.PropertyPaths) > 0 {
+			annotations = append(annotations, capabilityRestrictions("Capabilities.FilterRestrictions", "Filterable", true, "NonFilterableProperties", nonFilterable))
+		}
+		if len(nonSortable.PropertyPaths) > 0 {
+			annotations = append(annotations, capabilityRestrictions("Capabilities.SortRestrictions", "Sortable", true, "NonSortableProperties", nonSortable))
+		}
+	}
+
+	if hasNavigation && handler.ExpandHandler == nil {
+		annotations = append(annotations, capabilityRestrictions("Capabilities.ExpandRestrictions", "Expandable", false, "", nil))
+	} else if len(nonExpandable.NavigationPropertyPaths) > 0 {
+		annotations = append(annotations, capabilityRestrictions("Capabilities.ExpandRestrictions", "Expandable", true, "NonExpandableProperties", nonExpandable))
+	}
+
+	derived := annotations[:0]
+	for _, annotation := range annotations {
+		if registeredAnnotation("EntityContainer/"+entityType.EntityName(), annotation.Term) == nil {
+			derived = append(derived, annotation)
+		}
+	}
+	return derived
+}
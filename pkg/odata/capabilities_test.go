@@ -0,0 +1,165 @@
+package odata
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestLedgers struct {
+	ID      string            `json:"ID" odata:"key"`
+	Amount  float64           `json:"Amount" odata:"nosort"`
+	Memo    string            `json:"Memo" odata:"nofilter,nosort"`
+	Entries []TestLedgerLines `json:"Entries,omitempty" odata:"expand:Entries,noexpand"`
+	Account *TestLedgerLines  `json:"Account,omitempty" odata:"expand:Account"`
+}
+
+func (l TestLedgers) EntityName() string {
+	return "Ledgers"
+}
+
+func (l TestLedgers) GetRelationships() map[string]string {
+	return map[string]string{}
+}
+
+type TestLedgerLines struct {
+	ID string `json:"ID" odata:"key"`
+}
+
+func (l TestLedgerLines) EntityName() string {
+	return "LedgerLines"
+}
+
+func (l TestLedgerLines) GetRelationships() map[string]string {
+	return map[string]string{}
+}
+
+func TestCapabilityAnnotations(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## capabilities_test - TestCapabilityAnnotations")
+	fmt.Println("")
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+
+	// Read-only entity sets cannot be changed and their collections cannot
+	// be queried without a GetEntityHandler
+	RegisterEntity(TestLedgerLines{}, EntityHandler{})
+	RegisterEntity(TestLedgers{}, EntityHandler{
+		GetEntityHandler:    func(w http.ResponseWriter, r *http.Request) {},
+		CreateEntityHandler: func(w http.ResponseWriter, r *http.Request) {},
+		ExpandHandler:       DefaultExpandHandler{},
+		DeleteEntityHandler: func(w http.ResponseWriter, r *http.Request, id string) {},
+	})
+	RegisterEntityRelationship("Ledgers", "Entries", "LedgerLines", "one-to-many")
+	RegisterEntityRelationship("Ledgers", "Account", "LedgerLines", "one-to-one")
+
+	container := BuildMetadata().Schema("CatalogService").EntityContainer
+	lines := container.EntitySet("LedgerLines").Annotations
+	assert.Equal(t, []string{
+		"Capabilities.InsertRestrictions",
+		"Capabilities.UpdateRestrictions",
+		"Capabilities.DeleteRestrictions",
+		"Capabilities.CountRestrictions",
+		"Capabilities.FilterRestrictions",
+		"Capabilities.SortRestrictions",
+	}, annotationTerms(lines))
+	for _, annotation := range lines {
+		assert.Equal(t, "false", annotation.Record.PropertyValues[0].Bool, annotation.Term)
+	}
+
+	ledgers := container.EntitySet("Ledgers").Annotations
+	assert.Equal(t, []string{
+		"Capabilities.UpdateRestrictions",
+		"Capabilities.FilterRestrictions",
+		"Capabilities.SortRestrictions",
+		"Capabilities.ExpandRestrictions",
+	}, annotationTerms(ledgers))
+	assert.Equal(t, "Updatable", ledgers[0].Record.PropertyValues[0].Property)
+	assert.Equal(t, []string{"Memo"}, ledgers[1].Record.PropertyValues[1].Collection.PropertyPaths)
+	assert.Equal(t, []string{"Amount", "Memo"}, ledgers[2].Record.PropertyValues[1].Collection.PropertyPaths)
+	assert.Equal(t, "NonExpandableProperties", ledgers[3].Record.PropertyValues[1].Property)
+	assert.Equal(t, []string{"Entries"}, ledgers[3].Record.PropertyValues[1].Collection.NavigationPropertyPaths)
+
+	assert.Contains(t, GenerateMetadata(), `<PropertyValue Property="NonSortableProperties">`)
+
+	// Navigation properties cannot be expanded without an ExpandHandler
+	RegisterEntity(TestLedgers{}, EntityHandler{GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {}})
+	expand := findAnnotation(BuildMetadata().Schema("CatalogService").EntityContainer.EntitySet("Ledgers").Annotations, "Capabilities.ExpandRestrictions")
+	assert.Equal(t, "false", expand.Record.PropertyValues[0].Bool)
+	assert.Len(t, expand.Record.PropertyValues, 1)
+
+	// Restrictions registered for the entity set replace the derived ones
+	RegisterAnnotations("EntityContainer/Ledgers", CapabilitiesFilterRestrictions(false))
+	defer func() { vocabularyAnnotations = nil }()
+	ledgers = BuildMetadata().Schema("CatalogService").EntityContainer.EntitySet("Ledgers").Annotations
+	assert.Nil(t, findAnnotation(ledgers, "Capabilities.FilterRestrictions"))
+	assert.NotNil(t, findAnnotation(ledgers, "Capabilities.SortRestrictions"))
+}
+
+func TestNoFilterTag(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## capabilities_test - TestNoFilterTag")
+	fmt.Println("")
+	ledgers := []TestLedgers{{ID: "1", Amount: 10, Memo: "rent"}}
+
+	_, err := ApplyFilter(ledgers, "$filter=memo eq 'rent'")
+	assert.EqualError(t, err, "property Memo cannot be used in $filter")
+	_, err = ApplyFilter(ledgers, "$filter=Amount gt @a&@a=length(Memo)")
+	assert.EqualError(t, err, "property Memo cannot be used in $filter")
+
+	filtered, err := ApplyFilter(ledgers, "$filter=Amount gt 5")
+	assert.NoError(t, err)
+	assert.Len(t, filtered, 1)
+}
+
+func TestCapabilityTags(t *testing.T) {
+	assert.NoError(t, ValidateEntityTags(TestLedgers{}))
+
+	field, _ := reflect.TypeOf(struct {
+		Name string `odata:"noexpand"`
+	}{}).FieldByName("Name")
+	assert.Equal(t, []error{errors.New("noexpand requires a navigation property")}, fieldTagErrors(field))
+}
+
+func findAnnotation(annotations []*EdmAnnotation, term string) *EdmAnnotation {
+	for _, annotation := range annotations {
+		if annotation.Term == term {
+			return annotation
+		}
+	}
+	return nil
+}
+
+func TestNoExpandTag(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## capabilities_test - TestNoExpandTag")
+	fmt.Println("")
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	r := chi.NewRouter()
+	RegisterEntity(TestLedgerLines{}, EntityHandler{})
+	RegisterEntity(TestLedgers{}, EntityHandler{
+		GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {
+			CreateODataResponse(w, "Ledgers", []TestLedgers{{ID: "1"}})
+		},
+		ExpandHandler: DefaultExpandHandler{},
+	})
+	RegisterEntityRelationship("Ledgers", "Entries", "LedgerLines", "one-to-many")
+	RegisterEntityRelationship("Ledgers", "Account", "LedgerLines", "one-to-one")
+	RegisterRoutes(r)
+
+	for _, query := range []string{"$expand=Entries", "$expand=Entries/$ref", "$expand=Account,Entries($select=ID)"} {
+		w := sendEntity(r, "GET", "/odata/v4/Ledgers?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	w := sendEntity(r, "GET", "/odata/v4/Ledgers?$expand=*", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Wildcards leave noexpand properties out
+	assert.Equal(t, map[string]string{"Account": ""}, expandWildcards("Ledgers", map[string]string{"*": ""}))
+}
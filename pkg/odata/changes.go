@@ -0,0 +1,262 @@
+package odata
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Change is a change to an entity recorded by a ChangeTracker.
+type Change struct {
+	ID      string
+	Removed bool
+}
+
+// ChangeTracker records changes to entities so that clients that asked for
+// odata.track-changes can fetch only what changed through a delta link.
+// Writes made through the EntityCreator, EntityUpdater, EntityDeleter and
+// LinkHandler hooks are recorded automatically; HTTP-level handlers such as
+// CreateEntityHandler have to call RecordChange themselves.
+type ChangeTracker interface {
+	// RecordChange records that the entity id of entitySet was added or
+	// changed, or removed.
+	RecordChange(entitySet, id string, removed bool) error
+	// DeltaToken returns a token that marks the current state of entitySet.
+	DeltaToken(entitySet string) (string, error)
+	// ChangesSince returns the latest change of every entity of entitySet
+	// changed after token, together with a token marking the new state.
+	ChangesSince(entitySet, token string) ([]Change, string, error)
+}
+
+// ErrInvalidDeltaToken is returned by a ChangeTracker for a token it did not
+// issue or no longer knows.
+var ErrInvalidDeltaToken = errors.New("invalid delta token")
+
+// ChangeTracking is the tracker used for odata.track-changes and delta
+// links. Setting it to nil disables change tracking.
+var ChangeTracking ChangeTracker = NewMemoryChangeTracker()
+
+// MemoryChangeTracker is a ChangeTracker that keeps the latest change of each
+// entity in memory. Its tokens are sequence numbers shared by all entity
+// sets.
+type MemoryChangeTracker struct {
+	mu       sync.Mutex
+	sequence int64
+	changes  map[string]map[string]trackedChange
+}
+
+type trackedChange struct {
+	sequence int64
+	removed  bool
+}
+
+func NewMemoryChangeTracker() *MemoryChangeTracker {
+	return &MemoryChangeTracker{changes: make(map[string]map[string]trackedChange)}
+}
+
+func (t *MemoryChangeTracker) RecordChange(entitySet, id string, removed bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sequence++
+	if t.changes[entitySet] == nil {
+		t.changes[entitySet] = make(map[string]trackedChange)
+	}
+	t.changes[entitySet][id] = trackedChange{sequence: t.sequence, removed: removed}
+	return nil
+}
+
+func (t *MemoryChangeTracker) DeltaToken(entitySet string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strconv.FormatInt(t.sequence, 10), nil
+}
+
+func (t *MemoryChangeTracker) ChangesSince(entitySet, token string) ([]Change, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	since, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || since < 0 || since > t.sequence {
+		return nil, "", ErrInvalidDeltaToken
+	}
+
+	type sequencedChange struct {
+		Change
+		sequence int64
+	}
+	var changed []sequencedChange
+	for id, change := range t.changes[entitySet] {
+		if change.sequence > since {
+			changed = append(changed, sequencedChange{Change{ID: id, Removed: change.removed}, change.sequence})
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].sequence < changed[j].sequence })
+
+	changes := make([]Change, len(changed))
+	for i, change := range changed {
+		changes[i] = change.Change
+	}
+	return changes, strconv.FormatInt(t.sequence, 10), nil
+}
+
+// recordChange feeds a write to ChangeTracking.
+func recordChange(entitySet, id string, removed bool) {
+	if ChangeTracking == nil || id == "" {
+		return
+	}
+	if err := ChangeTracking.RecordChange(entitySet, id, removed); err != nil {
+		log.Printf("Failed to record change of %s(%s): %v", entitySet, id, err)
+	}
+}
+
+// recordLinkChange records a link change of the entity id of entitySet. For
+// collections the foreign key usually lives on the target, so the target is
+// recorded as changed as well.
+func recordLinkChange(entitySet, id string, relInfo RelationshipInfo, targetID string) {
+	recordChange(entitySet, id, false)
+	if relInfo.isCollection() {
+		recordChange(relInfo.TargetEntity, targetID, false)
+	}
+}
+
+// pendingChange is a change waiting in a changeBuffer.
+type pendingChange struct {
+	entitySet, id string
+	removed       bool
+}
+
+// changeBuffer collects the changes of a deep insert, deep update or delta
+// payload until its writes are committed.
+type changeBuffer []pendingChange
+
+func (b *changeBuffer) record(entitySet, id string, removed bool) {
+	*b = append(*b, pendingChange{entitySet, id, removed})
+}
+
+// recordLink buffers a link change like recordLinkChange.
+func (b *changeBuffer) recordLink(entitySet, id string, relInfo RelationshipInfo, targetID string) {
+	b.record(entitySet, id, false)
+	if relInfo.isCollection() {
+		b.record(relInfo.TargetEntity, targetID, false)
+	}
+}
+
+// flush feeds the buffered changes to ChangeTracking.
+func (b *changeBuffer) flush() {
+	for _, change := range *b {
+		recordChange(change.entitySet, change.id, change.removed)
+	}
+	*b = nil
+}
+
+// trackChanges honors the odata.track-changes preference for a read of
+// entitySet by attaching a delta link to the response.
+func trackChanges(w http.ResponseWriter, r *http.Request, entitySet string, handler EntityHandler) {
+	if _, ok := RequestPreferences(r).Get("odata.track-changes"); !ok {
+		return
+	}
+	pw := responsePreferences(w)
+	if pw == nil || ChangeTracking == nil || handler.EntityReader == nil {
+		return
+	}
+	token, err := ChangeTracking.DeltaToken(entitySet)
+	if err != nil {
+		log.Printf("Failed to get delta token of %s: %v", entitySet, err)
+		return
+	}
+	pw.apply("odata.track-changes")
+	pw.deltaLink = deltaLink(r, token)
+}
+
+// deltaLink returns the URL of r with its $deltatoken replaced by token, so
+// the delta keeps the query options of the original request.
+func deltaLink(r *http.Request, token string) string {
+	var options []string
+	for _, option := range strings.Split(r.URL.RawQuery, "&") {
+		if option != "" && !strings.HasPrefix(option, "$deltatoken=") {
+			options = append(options, option)
+		}
+	}
+	options = append(options, "$deltatoken="+token)
+	return r.URL.Path + "?" + strings.Join(options, "&")
+}
+
+// handleGetDelta serves a delta link: the entities of entitySet added or
+// changed since token, and entries for the ones removed.
+func handleGetDelta(w http.ResponseWriter, r *http.Request, entitySet string, handler EntityHandler, token string) {
+	log.Printf("Handling delta request for entitySet: %s, token: %s", entitySet, token)
+	if ChangeTracking == nil || handler.EntityReader == nil {
+		http.Error(w, "Change tracking not supported", http.StatusNotImplemented)
+		return
+	}
+
+	changes, nextToken, err := ChangeTracking.ChangesSince(entitySet, token)
+	if err != nil {
+		writeHandlerError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	value := make([]OrderedFields, 0, len(changes))
+	for _, change := range changes {
+		var entity interface{}
+		found := false
+		if !change.Removed {
+			entity, found = handler.ReadEntity(change.ID)
+		}
+		if !found {
+			value = append(value, removedEntry(entitySet, change.ID, "deleted"))
+			continue
+		}
+
+		// Entities that no longer match the filter left the result
+		if _, err := ApplyFilter(entity, r.URL.RawQuery); errors.Is(err, ErrEntityNotFound) {
+			value = append(value, removedEntry(entitySet, change.ID, "changed"))
+			continue
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		value = append(value, toOrderedFields(ApplySelect(entity, r.URL.RawQuery), ""))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("OData-Version", "4.0")
+	response := OrderedFields{
+		Fields: []struct{Key string; Value interface{}}{
+			{Key: "@odata.context", Value: entitySetContextURL(w, entitySet, "/$delta")},
+			{Key: "value", Value: value},
+			{Key: "@odata.deltaLink", Value: deltaLink(r, nextToken)},
+		},
+	}
+	encodeJSONPreserveOrder(w, response)
+}
+
+// removedEntry is the delta payload entry of an entity that was deleted or
+// no longer belongs to the result for the given reason.
+func removedEntry(entitySet, id, reason string) OrderedFields {
+	return OrderedFields{
+		EntityName: entitySet,
+		Fields: []struct{Key string; Value interface{}}{
+			{Key: "@removed", Value: map[string]string{"reason": reason}},
+			{Key: "@id", Value: entityIDReference(entitySet, id)},
+		},
+	}
+}
+
+// entityIDReference returns the reference of the entity with key id, quoting
+// the key for string keys.
+func entityIDReference(entitySet, id string) string {
+	model, ok := LookupEntityModel(entitySet)
+	if !ok || len(model.Keys) != 1 {
+		return entitySet + "(" + id + ")"
+	}
+	key, _ := model.Property(model.Keys[0])
+	if key.Field.Type.Kind() == reflect.String {
+		return entitySet + "(" + formatKeyValue(id) + ")"
+	}
+	return entitySet + "(" + id + ")"
+}
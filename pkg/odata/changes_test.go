@@ -0,0 +1,146 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// sendIfMatch sends body unconditionally to an entity set with optimistic
+// concurrency, which requires an If-Match header.
+func sendIfMatch(r *chi.Mux, method, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("If-Match", "*")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func setupChangesRouter() *chi.Mux {
+	testStock = []TestStock{
+		{ID: "1", Quantity: 10, Version: 1},
+		{ID: "2", Quantity: 20, Version: 1},
+	}
+	ChangeTracking = NewMemoryChangeTracker()
+
+	r := chi.NewRouter()
+	stockHandler := TestStockHandler{}
+	RegisterEntity(TestStock{}, EntityHandler{
+		GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {
+			filtered, err := ApplyFilter(testStock, r.URL.RawQuery)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			CreateODataResponse(w, "Stock", filtered)
+		},
+		EntityReader:  stockHandler,
+		EntityUpdater: stockHandler,
+		EntityDeleter: stockHandler,
+	})
+	RegisterRoutes(r)
+	return r
+}
+
+func getDelta(t *testing.T, r *chi.Mux, url string, trackChanges bool) map[string]interface{} {
+	req, _ := http.NewRequest("GET", url, nil)
+	if trackChanges {
+		req.Header.Set("Prefer", "odata.track-changes")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	if trackChanges {
+		assert.Equal(t, "odata.track-changes", w.Header().Get("Preference-Applied"))
+	}
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	return response
+}
+
+func TestChangeTracking(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## changes_test - TestChangeTracking")
+	fmt.Println("")
+	r := setupChangesRouter()
+
+	response := getDelta(t, r, "/odata/v4/Stock", true)
+	assert.Len(t, response["value"], 2)
+	deltaLink := response["@odata.deltaLink"].(string)
+	assert.Equal(t, "/odata/v4/Stock?$deltatoken=0", deltaLink)
+
+	t.Run("No changes", func(t *testing.T) {
+		response := getDelta(t, r, deltaLink, false)
+		assert.Equal(t, "/odata/v4/$metadata#Stock/$delta", response["@odata.context"])
+		assert.Empty(t, response["value"])
+		assert.Equal(t, deltaLink, response["@odata.deltaLink"])
+	})
+
+	t.Run("Changed and removed entities", func(t *testing.T) {
+		w := sendIfMatch(r, "PATCH", "/odata/v4/Stock('1')", `{"Quantity": 5}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = sendIfMatch(r, "DELETE", "/odata/v4/Stock('2')", "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		response := getDelta(t, r, deltaLink, false)
+		value := response["value"].([]interface{})
+		assert.Len(t, value, 2)
+		changed := value[0].(map[string]interface{})
+		assert.Equal(t, "1", changed["ID"])
+		assert.Equal(t, float64(5), changed["Quantity"])
+		removed := value[1].(map[string]interface{})
+		assert.Equal(t, map[string]interface{}{"reason": "deleted"}, removed["@removed"])
+		assert.Equal(t, "Stock('2')", removed["@id"])
+
+		nextLink := response["@odata.deltaLink"].(string)
+		assert.Equal(t, "/odata/v4/Stock?$deltatoken=2", nextLink)
+		assert.Empty(t, getDelta(t, r, nextLink, false)["value"])
+	})
+
+	t.Run("Delta keeps the defining query", func(t *testing.T) {
+		response := getDelta(t, r, "/odata/v4/Stock?$filter=Quantity%20gt%203&$select=Quantity", true)
+		deltaLink := response["@odata.deltaLink"].(string)
+		assert.Equal(t, "/odata/v4/Stock?$filter=Quantity%20gt%203&$select=Quantity&$deltatoken=2", deltaLink)
+
+		w := sendIfMatch(r, "PATCH", "/odata/v4/Stock('1')", `{"Quantity": 1}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		value := getDelta(t, r, deltaLink, false)["value"].([]interface{})
+		assert.Len(t, value, 1)
+		assert.Equal(t, map[string]interface{}{"reason": "changed"}, value[0].(map[string]interface{})["@removed"])
+
+		w = sendIfMatch(r, "PATCH", "/odata/v4/Stock('1')", `{"Quantity": 8}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		value = getDelta(t, r, deltaLink, false)["value"].([]interface{})
+		assert.Equal(t, map[string]interface{}{"@odata.etag": `W/"4"`, "Quantity": float64(8)}, value[0])
+	})
+
+	t.Run("Invalid delta token", func(t *testing.T) {
+		w := sendEntity(r, "GET", "/odata/v4/Stock?$deltatoken=99", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestMemoryChangeTracker(t *testing.T) {
+	tracker := NewMemoryChangeTracker()
+	token, _ := tracker.DeltaToken("Stock")
+	tracker.RecordChange("Stock", "1", false)
+	tracker.RecordChange("Stock", "2", false)
+	tracker.RecordChange("Orders", "O1", false)
+	tracker.RecordChange("Stock", "1", true)
+
+	changes, next, err := tracker.ChangesSince("Stock", token)
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{{ID: "2"}, {ID: "1", Removed: true}}, changes)
+	assert.Equal(t, "4", next)
+
+	_, _, err = tracker.ChangesSince("Stock", "x")
+	assert.ErrorIs(t, err, ErrInvalidDeltaToken)
+}
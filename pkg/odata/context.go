@@ -0,0 +1,101 @@
+package odata
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// TrustForwardedHeaders makes absolute URLs use the host and scheme of the
+// X-Forwarded-Host and X-Forwarded-Proto headers. Only enable it behind a
+// proxy that sets them, as clients could otherwise choose the URLs returned
+// by the service.
+var TrustForwardedHeaders = false
+
+// serviceRoot returns the absolute URL of the service root for r, taking
+// the scheme and host forwarded by a proxy into account if
+// TrustForwardedHeaders is set.
+func serviceRoot(r *http.Request) string {
+	host := r.Host
+	if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" && TrustForwardedHeaders {
+		host = forwardedHost
+	}
+	if host == "" {
+		return "/odata/v4/"
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if forwardedProto := r.Header.Get("X-Forwarded-Proto"); forwardedProto != "" && TrustForwardedHeaders {
+		scheme = forwardedProto
+	}
+	return scheme + "://" + host + "/odata/v4/"
+}
+
+// contextURL returns the context URL with the given fragment, e.g.
+// "Products/$entity". It is absolute for requests routed through
+// RegisterRoutes.
+func contextURL(w http.ResponseWriter, fragment string) string {
+	return metadataURL(w) + "#" + fragment
+}
+
+// metadataURL returns the URL of the metadata document, which is also the
+// context URL of the service document.
+func metadataURL(w http.ResponseWriter) string {
+	if pw := responsePreferences(w); pw != nil {
+		return pw.serviceRoot + "$metadata"
+	}
+	return "$metadata"
+}
+
+// entitySetContextURL returns the context URL of entities of entitySet
+// projected by the $select and $expand of the request, e.g.
+// "$metadata#Products(Name,Category(Name))", followed by suffix.
+func entitySetContextURL(w http.ResponseWriter, entitySet, suffix string) string {
+	pw := responsePreferences(w)
+	if pw == nil {
+		return contextURL(w, entitySet+suffix)
+	}
+	if selectList := contextSelectList(pw.query); selectList != "" {
+		entitySet += "(" + selectList + ")"
+	}
+	return contextURL(w, entitySet+suffix)
+}
+
+// contextSelectList builds the select list of a context URL from the $select
+// and $expand options of query. Expanded navigation properties are listed
+// with their nested select list in parentheses, which is empty when all
+// their properties are included.
+func contextSelectList(query string) string {
+	var items []string
+	expanded := make(map[string]bool)
+
+	expandParts := parseExpandQuery(query)
+	relationshipNames := make([]string, 0, len(expandParts))
+	for relationshipName := range expandParts {
+		relationshipNames = append(relationshipNames, relationshipName)
+	}
+	sort.Strings(relationshipNames)
+
+	var expandItems []string
+	for _, relationshipName := range relationshipNames {
+		relationshipName = strings.TrimSpace(relationshipName)
+		if relationshipName == "" || strings.Contains(relationshipName, "*") || strings.HasSuffix(relationshipName, "/$ref") {
+			continue
+		}
+		nestedQuery := strings.Join(splitTopLevel(expandParts[relationshipName], ';'), "&")
+		expandItems = append(expandItems, relationshipName+"("+contextSelectList(nestedQuery)+")")
+		expanded[relationshipName] = true
+	}
+
+	if selectQuery := ParseSelect(query); selectQuery != "" {
+		for _, item := range splitTopLevel(selectQuery, ',') {
+			if !expanded[item] {
+				items = append(items, item)
+			}
+		}
+	}
+	return strings.Join(append(items, expandItems...), ",")
+}
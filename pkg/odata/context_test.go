@@ -0,0 +1,93 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getContext(t *testing.T, req *http.Request) map[string]interface{} {
+	r := setupTestRouter()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "Unexpected status code: %s", w.Body.String())
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	return response
+}
+
+func TestContextURLIsAbsolute(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## context_test - TestContextURLIsAbsolute")
+	fmt.Println("")
+	req, _ := http.NewRequest("GET", "/odata/v4/Products", nil)
+	req.Host = "example.com"
+	response := getContext(t, req)
+	assert.Equal(t, "http://example.com/odata/v4/$metadata#Products", response["@odata.context"])
+
+	req, _ = http.NewRequest("GET", "/odata/v4/Products", nil)
+	req.Host = "internal:8080"
+	req.Header.Set("X-Forwarded-Host", "example.com")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	response = getContext(t, req)
+	assert.Equal(t, "http://internal:8080/odata/v4/$metadata#Products", response["@odata.context"])
+
+	TrustForwardedHeaders = true
+	defer func() { TrustForwardedHeaders = false }()
+	response = getContext(t, req)
+	assert.Equal(t, "https://example.com/odata/v4/$metadata#Products", response["@odata.context"])
+}
+
+func TestContextURLWithSelectAndExpand(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## context_test - TestContextURLWithSelectAndExpand")
+	fmt.Println("")
+	req, _ := http.NewRequest("GET", "/odata/v4/Products?$select=Name&$expand=Category($select=Name)", nil)
+	req.Host = "example.com"
+	response := getContext(t, req)
+	assert.Equal(t, "http://example.com/odata/v4/$metadata#Products(Name,Category(Name))", response["@odata.context"])
+
+	req, _ = http.NewRequest("GET", "/odata/v4/Products?$expand=Category", nil)
+	response = getContext(t, req)
+	assert.Equal(t, "/odata/v4/$metadata#Products(Category())", response["@odata.context"])
+}
+
+func TestContextURLOfProperty(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## context_test - TestContextURLOfProperty")
+	fmt.Println("")
+	req, _ := http.NewRequest("GET", "/odata/v4/Products('1')/Name", nil)
+	response := getContext(t, req)
+	assert.Equal(t, "/odata/v4/$metadata#Products('1')/Name", response["@odata.context"])
+	assert.Equal(t, "Product A", response["value"])
+}
+
+func TestContextURLOfNavigationProperty(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## context_test - TestContextURLOfNavigationProperty")
+	fmt.Println("")
+	req, _ := http.NewRequest("GET", "/odata/v4/Products('1')/Category?$select=Name", nil)
+	response := getContext(t, req)
+	assert.Equal(t, "/odata/v4/$metadata#Categories(Name)/$entity", response["@odata.context"])
+	assert.Equal(t, "Electronics", response["Name"])
+}
+
+func TestContextURLOfOperationResult(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## context_test - TestContextURLOfOperationResult")
+	fmt.Println("")
+	w := httptest.NewRecorder()
+	CreateODataValueResponse(w, "Edm.Int32", 42)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "$metadata#Edm.Int32", response["@odata.context"])
+	assert.Equal(t, float64(42), response["value"])
+}
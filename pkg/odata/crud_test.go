@@ -37,7 +37,7 @@ func TestGetProduct(t *testing.T) {
 			err := json.Unmarshal(w.Body.Bytes(), &response)
 			assert.NoError(t, err)
 
-			assert.Equal(t, "$metadata#Products/$entity", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
+			assert.Equal(t, "/odata/v4/$metadata#Products/$entity", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
 
 			assert.Equal(t, "1", response["ID"], "Unexpected ID: %v", response["ID"])
 			assert.Equal(t, "Product A", response["Name"], "Unexpected Name: %v", response["Name"])
@@ -60,7 +60,7 @@ func TestGetProducts(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "$metadata#Products", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
+	assert.Equal(t, "/odata/v4/$metadata#Products", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
 
 	values, ok := response["value"].([]interface{})
 	assert.True(t, ok, "Expected value to be a slice, got %T", response["value"])
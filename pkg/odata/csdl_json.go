@@ -0,0 +1,275 @@
+package odata
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// GenerateMetadataJSON returns the metadata document of the registered
+// entities in the JSON CSDL format, built from the same model as
+// GenerateMetadata.
+func GenerateMetadataJSON() string {
+	data, err := json.MarshalIndent(BuildMetadata().CSDLJSON(), "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode metadata: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// CSDLJSON converts the model to its JSON CSDL representation.
+func (e *Edmx) CSDLJSON() OrderedFields {
+	doc := OrderedFields{}
+	doc.add("$Version", e.Version)
+	for _, schema := range e.DataServices.Schemas {
+		if schema.EntityContainer != nil {
+			doc.add("$EntityContainer", schema.Namespace+"."+schema.EntityContainer.Name)
+			break
+		}
+	}
+	if len(e.References) > 0 {
+		references := OrderedFields{}
+		for _, reference := range e.References {
+			includes := make([]interface{}, 0, len(reference.Includes))
+			for _, include := range reference.Includes {
+				csdlInclude := OrderedFields{}
+				csdlInclude.add("$Namespace", include.Namespace)
+				if include.Alias != "" {
+					csdlInclude.add("$Alias", include.Alias)
+				}
+				includes = append(includes, csdlInclude)
+			}
+			references.add(reference.URI, OrderedFields{Fields: []struct{Key string; Value interface{}}{{"$Include", includes}}})
+		}
+		doc.add("$Reference", references)
+	}
+	for _, schema := range e.DataServices.Schemas {
+		doc.add(schema.Namespace, schema.csdlJSON())
+	}
+	return doc
+}
+
+func (s *EdmSchema) csdlJSON() OrderedFields {
+	schema := OrderedFields{}
+	for _, entityType := range s.EntityTypes {
+		schema.add(entityType.Name, entityType.csdlJSON())
+	}
+	if container := s.EntityContainer; container != nil {
+		csdlContainer := OrderedFields{}
+		csdlContainer.add("$Kind", "EntityContainer")
+		for _, entitySet := range container.EntitySets {
+			csdlContainer.add(entitySet.Name, entitySet.csdlJSON())
+		}
+		for _, singleton := range container.Singletons {
+			csdlContainer.add(singleton.Name, singleton.csdlJSON())
+		}
+		for _, functionImport := range container.FunctionImports {
+			csdlContainer.add(functionImport.Name, functionImport.csdlJSON())
+		}
+		schema.add(container.Name, csdlContainer)
+	}
+	if len(s.Annotations) > 0 {
+		annotations := OrderedFields{}
+		for _, targeted := range s.Annotations {
+			target := OrderedFields{}
+			addCSDLAnnotations(&target, targeted.Annotations)
+			annotations.add(targeted.Target, target)
+		}
+		schema.add("$Annotations", annotations)
+	}
+	return schema
+}
+
+func (t *EdmEntityType) csdlJSON() OrderedFields {
+	entityType := OrderedFields{}
+	entityType.add("$Kind", "EntityType")
+	if t.HasStream {
+		entityType.add("$HasStream", true)
+	}
+	if t.Key != nil {
+		keys := make([]interface{}, len(t.Key.PropertyRefs))
+		for i, ref := range t.Key.PropertyRefs {
+			keys[i] = ref.Name
+		}
+		entityType.add("$Key", keys)
+	}
+
+	for _, p := range t.Properties {
+		property := OrderedFields{}
+		addCSDLType(&property, p.Type)
+		// Properties are nullable by default in XML but not in JSON CSDL
+		if p.Nullable != "false" {
+			property.add("$Nullable", true)
+		}
+		if p.MaxLength != "" {
+			property.add("$MaxLength", csdlFacet(p.MaxLength))
+		}
+		if p.Precision != "" {
+			property.add("$Precision", csdlFacet(p.Precision))
+		}
+		if p.Scale != "" {
+			property.add("$Scale", csdlFacet(p.Scale))
+		}
+		addCSDLAnnotations(&property, p.Annotations)
+		entityType.add(p.Name, property)
+	}
+
+	for _, p := range t.NavigationProperties {
+		property := OrderedFields{}
+		property.add("$Kind", "NavigationProperty")
+		addCSDLType(&property, p.Type)
+		if p.Nullable == "true" || (p.Nullable == "" && !strings.HasPrefix(p.Type, "Collection(")) {
+			property.add("$Nullable", true)
+		}
+		if p.Partner != "" {
+			property.add("$Partner", p.Partner)
+		}
+		if len(p.ReferentialConstraints) > 0 {
+			constraints := OrderedFields{}
+			for _, constraint := range p.ReferentialConstraints {
+				constraints.add(constraint.Property, constraint.ReferencedProperty)
+			}
+			property.add("$ReferentialConstraint", constraints)
+		}
+		if p.OnDelete != nil {
+			property.add("$OnDelete", p.OnDelete.Action)
+		}
+		addCSDLAnnotations(&property, p.Annotations)
+		entityType.add(p.Name, property)
+	}
+
+	addCSDLAnnotations(&entityType, t.Annotations)
+	return entityType
+}
+
+func (s *EdmEntitySet) csdlJSON() OrderedFields {
+	entitySet := OrderedFields{}
+	entitySet.add("$Collection", true)
+	entitySet.add("$Type", s.EntityType)
+	addCSDLBindings(&entitySet, s.NavigationPropertyBindings)
+	addCSDLAnnotations(&entitySet, s.Annotations)
+	return entitySet
+}
+
+func (s *EdmSingleton) csdlJSON() OrderedFields {
+	singleton := OrderedFields{}
+	singleton.add("$Type", s.Type)
+	addCSDLBindings(&singleton, s.NavigationPropertyBindings)
+	addCSDLAnnotations(&singleton, s.Annotations)
+	return singleton
+}
+
+func (f *EdmFunctionImport) csdlJSON() OrderedFields {
+	functionImport := OrderedFields{}
+	functionImport.add("$Function", f.Function)
+	if f.EntitySet != "" {
+		functionImport.add("$EntitySet", f.EntitySet)
+	}
+	if f.IncludeInServiceDocument {
+		functionImport.add("$IncludeInServiceDocument", true)
+	}
+	addCSDLAnnotations(&functionImport, f.Annotations)
+	return functionImport
+}
+
+func addCSDLBindings(member *OrderedFields, bindings []*EdmNavigationPropertyBinding) {
+	if len(bindings) == 0 {
+		return
+	}
+	csdlBindings := OrderedFields{}
+	for _, binding := range bindings {
+		csdlBindings.add(binding.Path, binding.Target)
+	}
+	member.add("$NavigationPropertyBinding", csdlBindings)
+}
+
+// addCSDLType adds $Type, omitted for the default Edm.String, and
+// $Collection for collection types.
+func addCSDLType(member *OrderedFields, typeName string) {
+	if elementType, ok := strings.CutPrefix(typeName, "Collection("); ok {
+		member.add("$Collection", true)
+		typeName = strings.TrimSuffix(elementType, ")")
+	}
+	if typeName != "Edm.String" {
+		member.add("$Type", typeName)
+	}
+}
+
+// csdlFacet returns numeric facet values as numbers and symbolic ones such
+// as max or variable as strings.
+func csdlFacet(value string) interface{} {
+	if n, err := strconv.Atoi(value); err == nil {
+		return n
+	}
+	return value
+}
+
+func addCSDLAnnotations(member *OrderedFields, annotations []*EdmAnnotation) {
+	for _, annotation := range annotations {
+		key := "@" + annotation.Term
+		if annotation.Qualifier != "" {
+			key += "#" + annotation.Qualifier
+		}
+		member.add(key, annotation.EdmExpression.csdlJSON())
+	}
+}
+
+func (e EdmExpression) csdlJSON() interface{} {
+	switch {
+	case e.Collection != nil:
+		items := []interface{}{}
+		for _, path := range e.Collection.PropertyPaths {
+			items = append(items, map[string]string{"$PropertyPath": path})
+		}
+		for _, path := range e.Collection.NavigationPropertyPaths {
+			items = append(items, map[string]string{"$NavigationPropertyPath": path})
+		}
+		for _, s := range e.Collection.Strings {
+			items = append(items, s)
+		}
+		for _, record := range e.Collection.Records {
+			items = append(items, record.csdlJSON())
+		}
+		return items
+	case e.Record != nil:
+		return e.Record.csdlJSON()
+	case e.Bool != "":
+		return e.Bool == "true"
+	case e.Int != "":
+		if n, err := strconv.ParseInt(e.Int, 10, 64); err == nil {
+			return n
+		}
+		return e.Int
+	case e.EnumMember != "":
+		// Members are qualified with their type in XML, e.g.
+		// UI.ImportanceType/High, and listed by name in JSON
+		var members []string
+		for _, member := range strings.Fields(e.EnumMember) {
+			members = append(members, member[strings.LastIndex(member, "/")+1:])
+		}
+		return strings.Join(members, ",")
+	case e.Path != "":
+		return map[string]string{"$Path": e.Path}
+	case e.String != "":
+		return e.String
+	}
+	// Annotations without a value apply a Boolean term with true
+	return true
+}
+
+func (r *EdmRecord) csdlJSON() OrderedFields {
+	record := OrderedFields{}
+	if r.Type != "" {
+		record.add("@type", "#"+r.Type)
+	}
+	for _, value := range r.PropertyValues {
+		record.add(value.Property, value.EdmExpression.csdlJSON())
+	}
+	return record
+}
+
+func (of *OrderedFields) add(key string, value interface{}) {
+	of.Fields = append(of.Fields, struct{Key string; Value interface{}}{key, value})
+}
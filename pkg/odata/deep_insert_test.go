@@ -0,0 +1,260 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestOrders struct {
+	ID       string           `json:"ID" odata:"key"`
+	Customer string           `json:"Customer"`
+	Items    []TestOrderItems `json:"Items,omitempty" odata:"expand:Items"`
+}
+
+func (o TestOrders) EntityName() string {
+	return "Orders"
+}
+
+func (o TestOrders) GetRelationships() map[string]string {
+	return map[string]string{
+		"Items": "OrderItems",
+	}
+}
+
+type TestOrderItems struct {
+	ID       string      `json:"ID" odata:"key"`
+	Product  string      `json:"Product"`
+	Quantity int         `json:"Quantity"`
+	Order_ID string      `json:"Order_ID"`
+	Order    *TestOrders `json:"Order,omitempty" odata:"expand:Order"`
+}
+
+func (i TestOrderItems) EntityName() string {
+	return "OrderItems"
+}
+
+func (i TestOrderItems) GetRelationships() map[string]string {
+	return map[string]string{
+		"Order": "Orders",
+	}
+}
+
+var testOrders []TestOrders
+var testOrderItems []TestOrderItems
+
+type TestOrderHandler struct{}
+
+// CreateEntity generates the order key to check that it reaches the items.
+func (h TestOrderHandler) CreateEntity(entity interface{}) (interface{}, error) {
+	order := entity.(TestOrders)
+	order.ID = "O" + strconv.Itoa(len(testOrders)+1)
+	testOrders = append(testOrders, order)
+	return order, nil
+}
+
+func (h TestOrderHandler) ReadEntity(id string) (interface{}, bool) {
+	for _, order := range testOrders {
+		if order.ID == id {
+			return order, true
+		}
+	}
+	return nil, false
+}
+
+func (h TestOrderHandler) UpdateEntity(id string, entity interface{}) (interface{}, error) {
+	for i := range testOrders {
+		if testOrders[i].ID == id {
+			testOrders[i] = entity.(TestOrders)
+			return testOrders[i], nil
+		}
+	}
+	return nil, ErrEntityNotFound
+}
+
+func (h TestOrderHandler) DeleteEntity(id string) error {
+	for i := range testOrders {
+		if testOrders[i].ID == id {
+			testOrders = append(testOrders[:i], testOrders[i+1:]...)
+			return nil
+		}
+	}
+	return ErrEntityNotFound
+}
+
+func (h TestOrderHandler) ExpandEntity(entity OrderedFields, relationshipName string, subQuery string) interface{} {
+	var orderID string
+	for _, field := range entity.Fields {
+		if field.Key == "ID" {
+			orderID = field.Value.(string)
+		}
+	}
+
+	switch relationshipName {
+	case "Items":
+		items := []TestOrderItems{}
+		for _, item := range testOrderItems {
+			if item.Order_ID == orderID {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	return nil
+}
+
+type TestOrderItemHandler struct{}
+
+func (h TestOrderItemHandler) CreateEntity(entity interface{}) (interface{}, error) {
+	item := entity.(TestOrderItems)
+	testOrderItems = append(testOrderItems, item)
+	return item, nil
+}
+
+func (h TestOrderItemHandler) ReadEntity(id string) (interface{}, bool) {
+	for _, item := range testOrderItems {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+func (h TestOrderItemHandler) UpdateEntity(id string, entity interface{}) (interface{}, error) {
+	for i := range testOrderItems {
+		if testOrderItems[i].ID == id {
+			testOrderItems[i] = entity.(TestOrderItems)
+			return testOrderItems[i], nil
+		}
+	}
+	return nil, ErrEntityNotFound
+}
+
+func (h TestOrderItemHandler) DeleteEntity(id string) error {
+	for i := range testOrderItems {
+		if testOrderItems[i].ID == id {
+			testOrderItems = append(testOrderItems[:i], testOrderItems[i+1:]...)
+			return nil
+		}
+	}
+	return ErrEntityNotFound
+}
+
+func setupOrderRouter() *chi.Mux {
+	r := setupTestRouter()
+	orderHandler := TestOrderHandler{}
+	RegisterEntity(TestOrders{}, EntityHandler{
+		ExpandHandler: orderHandler,
+		EntityReader:  orderHandler,
+		EntityCreator: orderHandler,
+		EntityUpdater: orderHandler,
+		EntityDeleter: orderHandler,
+	})
+	itemHandler := TestOrderItemHandler{}
+	RegisterEntity(TestOrderItems{}, EntityHandler{
+		EntityReader:  itemHandler,
+		EntityCreator: itemHandler,
+		EntityUpdater: itemHandler,
+		EntityDeleter: itemHandler,
+	})
+	RegisterEntityRelationship("Orders", "Items", "OrderItems", "one-to-many")
+	RegisterEntityRelationship("OrderItems", "Order", "Orders", "one-to-one")
+	return r
+}
+
+func postEntity(r *chi.Mux, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateWithBind(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## deep_insert_test - TestCreateWithBind")
+	fmt.Println("")
+	r := setupTestRouter()
+
+	originalProducts := testProducts
+	defer func() { testProducts = originalProducts }()
+	testProducts = append([]TestProducts{}, originalProducts...)
+
+	w := postEntity(r, "/odata/v4/Products", `{"ID":"4","Name":"Product D","Price":10,"Category@odata.bind":"Categories('2')","Supplier@odata.bind":"Suppliers('1')"}`)
+
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, "Products('4')", w.Header().Get("Location"))
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "/odata/v4/$metadata#Products/$entity", response["@odata.context"])
+	assert.Equal(t, "2", response["Category_ID"])
+	assert.Equal(t, "1", response["Supplier_ID"])
+	assert.Len(t, testProducts, 4)
+
+	t.Run("Bind to the wrong entity set", func(t *testing.T) {
+		w := postEntity(r, "/odata/v4/Products", `{"ID":"5","Category@odata.bind":"Suppliers('2')"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Unknown property", func(t *testing.T) {
+		w := postEntity(r, "/odata/v4/Products", `{"ID":"5","Colour":"red"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestDeepInsert(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## deep_insert_test - TestDeepInsert")
+	fmt.Println("")
+	r := setupOrderRouter()
+
+	originalProducts, originalCategories := testProducts, testCategories
+	defer func() { testProducts, testCategories = originalProducts, originalCategories }()
+	testProducts = append([]TestProducts{}, originalProducts...)
+	testCategories = append([]TestCategories{}, originalCategories...)
+
+	t.Run("Single-valued nested entity", func(t *testing.T) {
+		w := postEntity(r, "/odata/v4/Products", `{"ID":"6","Name":"Teddy","Category":{"ID":"3","Name":"Toys"}}`)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "3", response["Category_ID"])
+		assert.Equal(t, map[string]interface{}{"ID": "3", "Name": "Toys"}, response["Category"])
+		assert.Equal(t, "Toys", testCategories[len(testCategories)-1].Name)
+	})
+
+	t.Run("Order with items", func(t *testing.T) {
+		testOrders, testOrderItems = nil, nil
+		w := postEntity(r, "/odata/v4/Orders", `{"Customer":"ACME","Items":[{"ID":"1","Product":"Bread","Quantity":2},{"ID":"2","Product":"Milk","Quantity":1}]}`)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.Equal(t, "Orders('O1')", w.Header().Get("Location"))
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "O1", response["ID"])
+		items, ok := response["Items"].([]interface{})
+		assert.True(t, ok, "Expected Items to be a slice")
+		assert.Len(t, items, 2)
+
+		assert.Len(t, testOrderItems, 2)
+		for _, item := range testOrderItems {
+			assert.Equal(t, "O1", item.Order_ID)
+		}
+	})
+
+	t.Run("Nested collection must be an array", func(t *testing.T) {
+		w := postEntity(r, "/odata/v4/Orders", `{"Customer":"ACME","Items":{"ID":"1"}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
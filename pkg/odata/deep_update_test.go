@@ -0,0 +1,270 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func sendEntity(r *chi.Mux, method, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func resetTestOrders() {
+	testOrders = []TestOrders{{ID: "O1", Customer: "ACME"}}
+	testOrderItems = []TestOrderItems{
+		{ID: "1", Product: "Bread", Quantity: 2, Order_ID: "O1"},
+		{ID: "2", Product: "Milk", Quantity: 1, Order_ID: "O1"},
+	}
+}
+
+func orderItemIDs() []string {
+	ids := []string{}
+	for _, item := range testOrderItems {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestDeepUpdate(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## deep_update_test - TestDeepUpdate")
+	fmt.Println("")
+	r := setupOrderRouter()
+
+	t.Run("Nested delta collection", func(t *testing.T) {
+		resetTestOrders()
+		w := sendEntity(r, "PATCH", "/odata/v4/Orders('O1')", `{
+			"Customer": "ACME Corp",
+			"Items@delta": [
+				{"@id": "OrderItems('1')", "Quantity": 5},
+				{"ID": "3", "Product": "Eggs", "Quantity": 12},
+				{"@removed": {"reason": "deleted"}, "@id": "OrderItems('2')"}
+			]
+		}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "ACME Corp", response["Customer"])
+		assert.Len(t, response["Items"], 2)
+
+		assert.Equal(t, "ACME Corp", testOrders[0].Customer)
+		assert.Equal(t, []string{"1", "3"}, orderItemIDs())
+		assert.Equal(t, "Bread", testOrderItems[0].Product, "Unchanged properties should be kept")
+		assert.Equal(t, 5, testOrderItems[0].Quantity)
+		assert.Equal(t, "O1", testOrderItems[1].Order_ID)
+	})
+
+	t.Run("Nested collection replaces related entities", func(t *testing.T) {
+		resetTestOrders()
+		w := sendEntity(r, "PATCH", "/odata/v4/Orders('O1')", `{"Items": [{"@id": "OrderItems('2')", "Quantity": 3}]}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, "ACME", testOrders[0].Customer)
+		assert.Equal(t, []string{"1", "2"}, orderItemIDs())
+		assert.Equal(t, "", testOrderItems[0].Order_ID)
+		assert.Equal(t, "O1", testOrderItems[1].Order_ID)
+		assert.Equal(t, 3, testOrderItems[1].Quantity)
+	})
+
+	t.Run("Removed as changed is unlinked", func(t *testing.T) {
+		resetTestOrders()
+		w := sendEntity(r, "PATCH", "/odata/v4/Orders('O1')", `{"Items@delta": [{"@removed": {"reason": "changed"}, "@id": "OrderItems('1')"}]}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.Equal(t, []string{"1", "2"}, orderItemIDs())
+		assert.Equal(t, "", testOrderItems[0].Order_ID)
+	})
+
+	t.Run("Unknown entity", func(t *testing.T) {
+		resetTestOrders()
+		w := sendEntity(r, "PATCH", "/odata/v4/Orders('O9')", `{"Customer": "Nobody"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Payload errors are bad requests", func(t *testing.T) {
+		resetTestOrders()
+		w := sendEntity(r, "PATCH", "/odata/v4/Orders('O1')", `{"@removed": {"reason": "deleted"}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		assert.Len(t, testOrders, 1)
+
+		w = sendEntity(r, "PATCH", "/odata/v4/Orders('O1')", `{"Items@delta": [{"Product": "Eggs"}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		assert.Equal(t, "OrderItems entity has no key value\n", w.Body.String())
+	})
+
+	t.Run("Entity set without updater", func(t *testing.T) {
+		w := sendEntity(r, "PATCH", "/odata/v4/Suppliers('1')", `{"Name": "Supplier Z"}`)
+		assert.Equal(t, http.StatusNotImplemented, w.Code)
+	})
+}
+
+func TestDeltaPayload(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## deep_update_test - TestDeltaPayload")
+	fmt.Println("")
+	r := setupOrderRouter()
+	resetTestOrders()
+
+	w := sendEntity(r, "PATCH", "/odata/v4/OrderItems", `{
+		"@context": "#$delta",
+		"value": [
+			{"@id": "OrderItems('1')", "Quantity": 7},
+			{"ID": "4", "Product": "Tea", "Quantity": 1, "Order_ID": "O1"},
+			{"@id": "OrderItems('2')", "@removed": {"reason": "deleted"}}
+		]
+	}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "/odata/v4/$metadata#OrderItems/$delta", response["@odata.context"])
+	assert.Len(t, response["value"], 2)
+
+	assert.Equal(t, []string{"1", "4"}, orderItemIDs())
+	assert.Equal(t, 7, testOrderItems[0].Quantity)
+}
+
+func TestDeleteEntity(t *testing.T) {
+	r := setupOrderRouter()
+	resetTestOrders()
+
+	w := sendEntity(r, "DELETE", "/odata/v4/Orders('O1')", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, testOrders)
+
+	w = sendEntity(r, "DELETE", "/odata/v4/Orders('O1')", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestOrderTransaction snapshots the orders and their items so that a failed
+// deep update can be rolled back.
+type TestOrderTransaction struct {
+	orders     *[]TestOrders
+	items      *[]TestOrderItems
+	rolledBack *bool
+}
+
+func (tx TestOrderTransaction) BeginTransaction() error {
+	*tx.orders = append([]TestOrders(nil), testOrders...)
+	*tx.items = append([]TestOrderItems(nil), testOrderItems...)
+	return nil
+}
+
+func (tx TestOrderTransaction) CommitTransaction() error {
+	return nil
+}
+
+func (tx TestOrderTransaction) RollbackTransaction() error {
+	testOrders, testOrderItems = *tx.orders, *tx.items
+	*tx.rolledBack = true
+	return nil
+}
+
+// TestFailingOrderItemHandler fails to create items of unknown products.
+type TestFailingOrderItemHandler struct {
+	TestOrderItemHandler
+}
+
+func (h TestFailingOrderItemHandler) CreateEntity(entity interface{}) (interface{}, error) {
+	if entity.(TestOrderItems).Product == "" {
+		return nil, fmt.Errorf("%w: unknown product", ErrEntityNotFound)
+	}
+	return h.TestOrderItemHandler.CreateEntity(entity)
+}
+
+func registerFailingOrderItems() {
+	itemHandler := TestFailingOrderItemHandler{}
+	RegisterEntity(TestOrderItems{}, EntityHandler{
+		EntityReader:  itemHandler,
+		EntityCreator: itemHandler,
+		EntityUpdater: itemHandler,
+		EntityDeleter: itemHandler,
+	})
+}
+
+func TestDeepUpdateFailures(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## deep_update_test - TestDeepUpdateFailures")
+	fmt.Println("")
+	failingUpdate := `{
+		"Customer": "Changed",
+		"Items@delta": [
+			{"ID": "3", "Product": "Eggs", "Quantity": 12},
+			{"ID": "4", "Quantity": 1}
+		]
+	}`
+
+	t.Run("Missing handler writes nothing", func(t *testing.T) {
+		r := setupOrderRouter()
+		itemHandler := TestOrderItemHandler{}
+		RegisterEntity(TestOrderItems{}, EntityHandler{
+			EntityReader:  itemHandler,
+			EntityCreator: itemHandler,
+			EntityUpdater: itemHandler,
+		})
+		resetTestOrders()
+		w := sendEntity(r, "PATCH", "/odata/v4/Orders('O1')", `{
+			"Customer": "Changed",
+			"Items@delta": [{"@removed": {"reason": "deleted"}, "@id": "OrderItems('2')"}]
+		}`)
+		assert.Equal(t, http.StatusNotImplemented, w.Code)
+		assert.Equal(t, "ACME", testOrders[0].Customer)
+		assert.Equal(t, []string{"1", "2"}, orderItemIDs())
+	})
+
+	t.Run("Failed write without transaction keeps earlier writes", func(t *testing.T) {
+		r := setupOrderRouter()
+		registerFailingOrderItems()
+		resetTestOrders()
+		w := sendEntity(r, "PATCH", "/odata/v4/Orders('O1')", failingUpdate)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "Changed", testOrders[0].Customer)
+		assert.Equal(t, []string{"1", "2", "3"}, orderItemIDs())
+	})
+
+	t.Run("Failed write is rolled back", func(t *testing.T) {
+		r := setupOrderRouter()
+		orderHandler := TestOrderHandler{}
+		rolledBack := false
+		registerFailingOrderItems()
+		RegisterEntity(TestOrders{}, EntityHandler{
+			GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {
+				CreateODataResponse(w, "Orders", testOrders)
+			},
+			ExpandHandler: orderHandler,
+			EntityReader:  orderHandler,
+			EntityCreator: orderHandler,
+			EntityUpdater: orderHandler,
+			EntityDeleter: orderHandler,
+			Transactioner: TestOrderTransaction{orders: &[]TestOrders{}, items: &[]TestOrderItems{}, rolledBack: &rolledBack},
+		})
+		resetTestOrders()
+		ChangeTracking = NewMemoryChangeTracker()
+		deltaLink := getDelta(t, r, "/odata/v4/Orders", true)["@odata.deltaLink"].(string)
+
+		w := sendEntity(r, "PATCH", "/odata/v4/Orders('O1')", failingUpdate)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.True(t, rolledBack)
+		assert.Equal(t, "ACME", testOrders[0].Customer)
+		assert.Equal(t, []string{"1", "2"}, orderItemIDs())
+
+		// Rolled back writes are not reported as changes
+		assert.Empty(t, getDelta(t, r, deltaLink, false)["value"])
+		w = sendEntity(r, "PATCH", "/odata/v4/Orders('O1')", `{"Customer": "Changed"}`)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Len(t, getDelta(t, r, deltaLink, false)["value"], 1)
+	})
+}
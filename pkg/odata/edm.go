@@ -0,0 +1,219 @@
+package odata
+
+import "encoding/xml"
+
+// Edmx is the root of a CSDL metadata document. BuildMetadata constructs it
+// from the registered entities; it can be inspected and modified before it
+// is serialized with encoding/xml.
+type Edmx struct {
+	XMLName      xml.Name        `xml:"edmx:Edmx"`
+	Version      string          `xml:"Version,attr"`
+	XmlnsEdmx    string          `xml:"xmlns:edmx,attr"`
+	References   []*EdmReference `xml:"edmx:Reference"`
+	DataServices EdmDataServices `xml:"edmx:DataServices"`
+}
+
+// EdmReference references the vocabulary or schema document at URI.
+type EdmReference struct {
+	URI      string        `xml:"Uri,attr"`
+	Includes []*EdmInclude `xml:"edmx:Include"`
+}
+
+type EdmInclude struct {
+	Namespace string `xml:"Namespace,attr"`
+	Alias     string `xml:"Alias,attr,omitempty"`
+}
+
+type EdmDataServices struct {
+	Schemas []*EdmSchema `xml:"Schema"`
+}
+
+type EdmSchema struct {
+	Xmlns           string              `xml:"xmlns,attr"`
+	Namespace       string              `xml:"Namespace,attr"`
+	EntityTypes     []*EdmEntityType    `xml:"EntityType"`
+	EntityContainer *EdmEntityContainer `xml:"EntityContainer"`
+	Annotations     []*EdmAnnotations   `xml:"Annotations"`
+}
+
+type EdmEntityType struct {
+	Name                 string                   `xml:"Name,attr"`
+	HasStream            bool                     `xml:"HasStream,attr,omitempty"`
+	Key                  *EdmKey                  `xml:"Key"`
+	Properties           []*EdmProperty           `xml:"Property"`
+	NavigationProperties []*EdmNavigationProperty `xml:"NavigationProperty"`
+	Annotations          []*EdmAnnotation         `xml:"Annotation"`
+}
+
+type EdmKey struct {
+	PropertyRefs []*EdmPropertyRef `xml:"PropertyRef"`
+}
+
+type EdmPropertyRef struct {
+	Name string `xml:"Name,attr"`
+}
+
+// EdmProperty is a structural property. Nullable, MaxLength, Precision and
+// Scale are omitted when empty, leaving the CSDL defaults.
+type EdmProperty struct {
+	Name        string           `xml:"Name,attr"`
+	Type        string           `xml:"Type,attr"`
+	Nullable    string           `xml:"Nullable,attr,omitempty"`
+	MaxLength   string           `xml:"MaxLength,attr,omitempty"`
+	Precision   string           `xml:"Precision,attr,omitempty"`
+	Scale       string           `xml:"Scale,attr,omitempty"`
+	Annotations []*EdmAnnotation `xml:"Annotation"`
+}
+
+type EdmNavigationProperty struct {
+	Name                   string                      `xml:"Name,attr"`
+	Type                   string                      `xml:"Type,attr"`
+	Nullable               string                      `xml:"Nullable,attr,omitempty"`
+	Partner                string                      `xml:"Partner,attr,omitempty"`
+	ReferentialConstraints []*EdmReferentialConstraint `xml:"ReferentialConstraint"`
+	OnDelete               *EdmOnDelete                `xml:"OnDelete"`
+	Annotations            []*EdmAnnotation            `xml:"Annotation"`
+}
+
+type EdmReferentialConstraint struct {
+	Property           string `xml:"Property,attr"`
+	ReferencedProperty string `xml:"ReferencedProperty,attr"`
+}
+
+// EdmOnDelete is the action applied to related entities when the source
+// entity is deleted, e.g. Cascade.
+type EdmOnDelete struct {
+	Action string `xml:"Action,attr"`
+}
+
+type EdmEntityContainer struct {
+	Name            string               `xml:"Name,attr"`
+	EntitySets      []*EdmEntitySet      `xml:"EntitySet"`
+	Singletons      []*EdmSingleton      `xml:"Singleton"`
+	FunctionImports []*EdmFunctionImport `xml:"FunctionImport"`
+}
+
+type EdmEntitySet struct {
+	Name                       string                          `xml:"Name,attr"`
+	EntityType                 string                          `xml:"EntityType,attr"`
+	NavigationPropertyBindings []*EdmNavigationPropertyBinding `xml:"NavigationPropertyBinding"`
+	Annotations                []*EdmAnnotation                `xml:"Annotation"`
+}
+
+// EdmSingleton is a single entity addressed by name, e.g. /odata/v4/Me.
+type EdmSingleton struct {
+	Name                       string                          `xml:"Name,attr"`
+	Type                       string                          `xml:"Type,attr"`
+	NavigationPropertyBindings []*EdmNavigationPropertyBinding `xml:"NavigationPropertyBinding"`
+	Annotations                []*EdmAnnotation                `xml:"Annotation"`
+}
+
+// EdmFunctionImport exposes the unbound function Function in the container.
+type EdmFunctionImport struct {
+	Name                     string           `xml:"Name,attr"`
+	Function                 string           `xml:"Function,attr"`
+	EntitySet                string           `xml:"EntitySet,attr,omitempty"`
+	IncludeInServiceDocument bool             `xml:"IncludeInServiceDocument,attr,omitempty"`
+	Annotations              []*EdmAnnotation `xml:"Annotation"`
+}
+
+type EdmNavigationPropertyBinding struct {
+	Path   string `xml:"Path,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+// EdmAnnotations applies annotations to the model element Target, e.g.
+// "CatalogService.Products/Name", from outside of it.
+type EdmAnnotations struct {
+	Target      string           `xml:"Target,attr"`
+	Annotations []*EdmAnnotation `xml:"Annotation"`
+}
+
+// EdmAnnotation applies the vocabulary term Term, e.g. "Core.Description",
+// with the value given by its expression.
+type EdmAnnotation struct {
+	Term      string `xml:"Term,attr"`
+	Qualifier string `xml:"Qualifier,attr,omitempty"`
+	EdmExpression
+}
+
+// EdmExpression is the value of an annotation or record property. Only one
+// of its fields is set. Constant values are kept in their CSDL string form,
+// e.g. Bool "true".
+type EdmExpression struct {
+	String     string         `xml:"String,attr,omitempty"`
+	Bool       string         `xml:"Bool,attr,omitempty"`
+	Int        string         `xml:"Int,attr,omitempty"`
+	EnumMember string         `xml:"EnumMember,attr,omitempty"`
+	Path       string         `xml:"Path,attr,omitempty"`
+	Collection *EdmCollection `xml:"Collection"`
+	Record     *EdmRecord     `xml:"Record"`
+}
+
+// EdmCollection is a collection expression of paths, strings or records.
+type EdmCollection struct {
+	PropertyPaths           []string     `xml:"PropertyPath"`
+	NavigationPropertyPaths []string     `xml:"NavigationPropertyPath"`
+	Strings                 []string     `xml:"String"`
+	Records                 []*EdmRecord `xml:"Record"`
+}
+
+type EdmRecord struct {
+	Type           string              `xml:"Type,attr,omitempty"`
+	PropertyValues []*EdmPropertyValue `xml:"PropertyValue"`
+}
+
+type EdmPropertyValue struct {
+	Property string `xml:"Property,attr"`
+	EdmExpression
+}
+
+// Schema returns the schema with the given namespace.
+func (e *Edmx) Schema(namespace string) *EdmSchema {
+	for _, schema := range e.DataServices.Schemas {
+		if schema.Namespace == namespace {
+			return schema
+		}
+	}
+	return nil
+}
+
+// EntityType returns the entity type with the given name.
+func (s *EdmSchema) EntityType(name string) *EdmEntityType {
+	for _, entityType := range s.EntityTypes {
+		if entityType.Name == name {
+			return entityType
+		}
+	}
+	return nil
+}
+
+// EntitySet returns the entity set with the given name.
+func (c *EdmEntityContainer) EntitySet(name string) *EdmEntitySet {
+	for _, entitySet := range c.EntitySets {
+		if entitySet.Name == name {
+			return entitySet
+		}
+	}
+	return nil
+}
+
+// Property returns the structural property with the given name.
+func (t *EdmEntityType) Property(name string) *EdmProperty {
+	for _, property := range t.Properties {
+		if property.Name == name {
+			return property
+		}
+	}
+	return nil
+}
+
+// NavigationProperty returns the navigation property with the given name.
+func (t *EdmEntityType) NavigationProperty(name string) *EdmNavigationProperty {
+	for _, property := range t.NavigationProperties {
+		if property.Name == name {
+			return property
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package odata
 
 import (
+	"errors"
+	"io"
 	"net/http"
 )
 
@@ -13,10 +15,130 @@ type ExpandHandler interface {
 	ExpandEntity(entity OrderedFields, relationshipName string, subQuery string) interface{}
 }
 
+// EntityReader looks up a single entity by key outside of an HTTP handler,
+// for example to resolve $root references in query expressions.
+type EntityReader interface {
+	ReadEntity(id string) (interface{}, bool)
+}
+
+// LinkHandler binds and unbinds related entities addressed through $ref.
+// For single-valued relationships CreateLink replaces the current link and
+// DeleteLink is called with an empty targetID.
+type LinkHandler interface {
+	CreateLink(id, relationshipName, targetID string) error
+	DeleteLink(id, relationshipName, targetID string) error
+}
+
+// EntityCreator creates an entity outside of an HTTP handler. It serves POST
+// requests when no CreateEntityHandler is set and creates the entities
+// nested in a deep insert. entity is a value of the registered entity type;
+// the created entity, including any generated key, must be returned.
+type EntityCreator interface {
+	CreateEntity(entity interface{}) (interface{}, error)
+}
+
+// EntityUpdater updates an existing entity outside of an HTTP handler. It
+// serves PATCH requests when no UpdateEntityHandler is set and updates the
+// entities nested in a deep update or delta payload. entity holds the
+// current entity read through EntityReader with the changes applied.
+type EntityUpdater interface {
+	UpdateEntity(id string, entity interface{}) (interface{}, error)
+}
+
+// EntityDeleter deletes an entity outside of an HTTP handler. It serves
+// DELETE requests when no DeleteEntityHandler is set and removes the entities
+// marked as deleted in delta payloads.
+type EntityDeleter interface {
+	DeleteEntity(id string) error
+}
+
+// MediaHandler reads and writes binary content: the media resource of a media
+// entity, addressed through $value, when property is empty, and otherwise
+// the named stream property of the entity. A returned reader that is also an
+// io.Closer is closed once it has been sent.
+type MediaHandler interface {
+	ReadMedia(id, property string) (content io.Reader, contentType string, err error)
+	WriteMedia(id, property string, content io.Reader, contentType string) error
+}
+
+// ConditionalUpdater can be implemented by an EntityUpdater to update the
+// entity id only if its ETag is still etag, the ETag the If-Match header of
+// the request was checked against. It returns ErrPreconditionFailed when the
+// entity changed in the meantime, so that concurrent updates are not lost.
+type ConditionalUpdater interface {
+	UpdateEntityIfMatch(id, etag string, entity interface{}) (interface{}, error)
+}
+
+// ConditionalDeleter can be implemented by an EntityDeleter to delete the
+// entity id only if its ETag is still etag, like ConditionalUpdater.
+type ConditionalDeleter interface {
+	DeleteEntityIfMatch(id, etag string) error
+}
+
+// Transactioner groups the writes of a deep insert, deep update or delta
+// payload. BeginTransaction is called before the first write, then
+// CommitTransaction after the last one, or RollbackTransaction when a write
+// fails so that the store can undo the writes already made.
+type Transactioner interface {
+	BeginTransaction() error
+	CommitTransaction() error
+	RollbackTransaction() error
+}
+
+// ErrEntityNotFound can be returned by handlers to signal a missing entity,
+// which is reported to the client as 404 Not Found.
+var ErrEntityNotFound = errors.New("entity not found")
+
+// ErrNotImplemented signals that an entity set lacks the handler needed for
+// a request, which is reported to the client as 501 Not Implemented.
+var ErrNotImplemented = errors.New("not implemented")
+
+// ErrPreconditionFailed can be returned by a ConditionalUpdater or
+// ConditionalDeleter whose entity no longer has the expected ETag, which is
+// reported to the client as 412 Precondition Failed.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ErrBadRequest marks errors in a request payload, such as an @removed entry
+// outside a collection, which are reported to the client as 400 Bad Request.
+var ErrBadRequest = errors.New("bad request")
+
+// badRequestError wraps a payload error as ErrBadRequest, keeping its
+// message.
+type badRequestError struct {
+	err error
+}
+
+func (e badRequestError) Error() string {
+	return e.err.Error()
+}
+
+func (e badRequestError) Unwrap() []error {
+	return []error{ErrBadRequest, e.err}
+}
+
+// badRequest marks err as ErrBadRequest unless it already maps to a status
+// of its own.
+func badRequest(err error) error {
+	if err == nil || errors.Is(err, ErrEntityNotFound) || errors.Is(err, ErrNotImplemented) || errors.Is(err, ErrPreconditionFailed) {
+		return err
+	}
+	return badRequestError{err}
+}
+
 type EntityHandler struct {
 	GetEntityHandler     func(http.ResponseWriter, *http.Request)
 	GetEntityByIDHandler func(http.ResponseWriter, *http.Request, string)
+	CreateEntityHandler  func(http.ResponseWriter, *http.Request)
+	UpdateEntityHandler  func(http.ResponseWriter, *http.Request, string)
+	DeleteEntityHandler  func(http.ResponseWriter, *http.Request, string)
 	ExpandHandler
+	EntityReader
+	LinkHandler
+	EntityCreator
+	EntityUpdater
+	EntityDeleter
+	MediaHandler
+	Transactioner
 }
 
 // OrderedFields represents a slice of key-value pairs to maintain field order
@@ -31,6 +153,14 @@ type OrderedFields struct {
 type RelationshipInfo struct {
 	TargetEntity string
 	Type         string // "one-to-one", "one-to-many", etc.
+	RelationshipOptions
+}
+
+func (r RelationshipInfo) isCollection() bool {
+	if r.Multiplicity != "" {
+		return r.Multiplicity == MultiplicityMany
+	}
+	return r.Type == "one-to-many" || r.Type == "many-to-many"
 }
 
 var entityTypes = []Entity{}
@@ -42,6 +172,17 @@ func GetEntityHandler(entityName string) (EntityHandler, bool) {
 	return handler, ok
 }
 
+// lookupEntityType returns the registered entity type for entityName. Later
+// registrations take precedence, matching entityHandlers.
+func lookupEntityType(entityName string) (Entity, bool) {
+	for i := len(entityTypes) - 1; i >= 0; i-- {
+		if entityTypes[i].EntityName() == entityName {
+			return entityTypes[i], true
+		}
+	}
+	return nil, false
+}
+
 // DefaultExpandHandler is a fallback handler that does nothing
 type DefaultExpandHandler struct{}
 
@@ -0,0 +1,152 @@
+package odata
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ETagProvider can be implemented by entities that compute their own ETag
+// instead of tagging a field with odata:"etag".
+type ETagProvider interface {
+	ETag() string
+}
+
+// entityETag returns the ETag of entity, or "" if its type has neither an
+// ETag() method nor a field tagged odata:"etag".
+func entityETag(entity interface{}) string {
+	if provider, ok := entity.(ETagProvider); ok {
+		return formatETag(provider.ETag())
+	}
+
+	val := reflect.ValueOf(entity)
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return ""
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return ""
+	}
+	if model := modelOf(val.Type()); len(model.ETags) > 0 {
+		property, _ := model.Property(model.ETags[0])
+		return formatETag(fmt.Sprint(property.Value(val).Interface()))
+	}
+	return ""
+}
+
+// hasOptimisticConcurrency reports whether entities of the type carry an
+// ETag.
+func hasOptimisticConcurrency(entityType Entity) bool {
+	if _, ok := entityType.(ETagProvider); ok {
+		return true
+	}
+	return len(modelOf(reflect.TypeOf(entityType)).ETags) > 0
+}
+
+// formatETag quotes value as a weak entity tag unless it already is one.
+func formatETag(value string) string {
+	if value == "" || strings.HasPrefix(value, `"`) || strings.HasPrefix(value, `W/"`) {
+		return value
+	}
+	return `W/"` + value + `"`
+}
+
+// etagMatches reports whether etag matches the list of entity tags in an
+// If-Match or If-None-Match header, using weak comparison.
+func etagMatches(header, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPreconditions enforces If-Match and If-None-Match for a request that
+// modifies the entity id, reading its current ETag through the EntityReader.
+// Entity sets with optimistic concurrency require one of the headers. It
+// returns the current ETag that If-Match was checked against, or "" if there
+// is none to compare the write against, and writes the error response and
+// returns false if the request must not proceed.
+func checkPreconditions(w http.ResponseWriter, r *http.Request, entitySet string, handler EntityHandler, id string) (string, bool) {
+	ifMatch := r.Header.Get("If-Match")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		if entityType, ok := lookupEntityType(entitySet); ok && hasOptimisticConcurrency(entityType) {
+			http.Error(w, "If-Match is required to modify "+entitySet, http.StatusPreconditionRequired)
+			return "", false
+		}
+		return "", true
+	}
+	if handler.EntityReader == nil {
+		http.Error(w, "Conditional requests require an EntityReader", http.StatusNotImplemented)
+		return "", false
+	}
+
+	current, found := handler.ReadEntity(id)
+	if !found {
+		http.Error(w, "Entity not found", http.StatusNotFound)
+		return "", false
+	}
+	etag := entityETag(current)
+	if ifMatch == "*" {
+		etag = "*"
+	}
+
+	if ifMatch != "" && !etagMatches(ifMatch, etag) {
+		http.Error(w, "ETag does not match", http.StatusPreconditionFailed)
+		return "", false
+	}
+	if ifNoneMatch != "" && (ifNoneMatch == "*" || etagMatches(ifNoneMatch, etag)) {
+		http.Error(w, "ETag matches", http.StatusPreconditionFailed)
+		return "", false
+	}
+	if ifMatch == "" || etag == "*" {
+		return "", true
+	}
+	return etag, true
+}
+
+// conditionalResponseWriter turns a 200 OK response into 304 Not Modified
+// when the ETag set by the handler matches the request's If-None-Match.
+type conditionalResponseWriter struct {
+	http.ResponseWriter
+	ifNoneMatch string
+	wroteHeader bool
+	notModified bool
+}
+
+func (w *conditionalResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status == http.StatusOK && etagMatches(w.ifNoneMatch, w.Header().Get("ETag")) {
+		w.notModified = true
+		w.Header().Del("Content-Type")
+		w.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *conditionalResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.notModified {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *conditionalResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,224 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestStock struct {
+	ID       string `json:"ID" odata:"key"`
+	Quantity int    `json:"Quantity"`
+	Version  int    `json:"Version" odata:"etag"`
+}
+
+func (s TestStock) EntityName() string {
+	return "Stock"
+}
+
+func (s TestStock) GetRelationships() map[string]string {
+	return map[string]string{}
+}
+
+type TestVersionedNote struct {
+	ID   string `json:"ID" odata:"key"`
+	Text string `json:"Text"`
+}
+
+func (n TestVersionedNote) EntityName() string {
+	return "Notes"
+}
+
+func (n TestVersionedNote) GetRelationships() map[string]string {
+	return map[string]string{}
+}
+
+func (n TestVersionedNote) ETag() string {
+	return strconv.Itoa(len(n.Text))
+}
+
+var testStock []TestStock
+
+type TestStockHandler struct{}
+
+func (h TestStockHandler) ReadEntity(id string) (interface{}, bool) {
+	for _, stock := range testStock {
+		if stock.ID == id {
+			return stock, true
+		}
+	}
+	return nil, false
+}
+
+func (h TestStockHandler) UpdateEntity(id string, entity interface{}) (interface{}, error) {
+	for i := range testStock {
+		if testStock[i].ID == id {
+			stock := entity.(TestStock)
+			stock.Version = testStock[i].Version + 1
+			testStock[i] = stock
+			return stock, nil
+		}
+	}
+	return nil, ErrEntityNotFound
+}
+
+// UpdateEntityIfMatch rejects updates of stock changed since etag was read.
+func (h TestStockHandler) UpdateEntityIfMatch(id, etag string, entity interface{}) (interface{}, error) {
+	if current, found := h.ReadEntity(id); found && entityETag(current) != etag {
+		return nil, ErrPreconditionFailed
+	}
+	return h.UpdateEntity(id, entity)
+}
+
+func (h TestStockHandler) DeleteEntity(id string) error {
+	for i := range testStock {
+		if testStock[i].ID == id {
+			testStock = append(testStock[:i], testStock[i+1:]...)
+			return nil
+		}
+	}
+	return ErrEntityNotFound
+}
+
+func setupStockRouter() *chi.Mux {
+	testStock = []TestStock{{ID: "1", Quantity: 10, Version: 1}}
+
+	r := chi.NewRouter()
+	stockHandler := TestStockHandler{}
+	RegisterEntity(TestStock{}, EntityHandler{
+		GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {
+			CreateODataResponse(w, "Stock", testStock)
+		},
+		GetEntityByIDHandler: func(w http.ResponseWriter, r *http.Request, id string) {
+			stock, ok := stockHandler.ReadEntity(id)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			CreateODataResponseSingle(w, "Stock", ApplySelect(stock, r.URL.RawQuery))
+		},
+		EntityReader:  stockHandler,
+		EntityUpdater: stockHandler,
+		EntityDeleter: stockHandler,
+	})
+	RegisterRoutes(r)
+	return r
+}
+
+func TestETag(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## etag_test - TestETag")
+	fmt.Println("")
+	r := setupStockRouter()
+
+	t.Run("ETag in payload and header", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Stock/1?$select=Quantity", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `W/"1"`, w.Header().Get("ETag"))
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, `W/"1"`, response["@odata.etag"])
+		assert.Equal(t, float64(10), response["Quantity"])
+	})
+
+	t.Run("ETag per entity in collections", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Stock", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		values := response["value"].([]interface{})
+		assert.Equal(t, `W/"1"`, values[0].(map[string]interface{})["@odata.etag"])
+	})
+
+	t.Run("If-None-Match returns not modified", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Stock/1", nil)
+		req.Header.Set("If-None-Match", `W/"1"`)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("If-Match mismatch is rejected", func(t *testing.T) {
+		req, _ := http.NewRequest("PATCH", "/odata/v4/Stock('1')", strings.NewReader(`{"Quantity": 5}`))
+		req.Header.Set("If-Match", `W/"0"`)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, 10, testStock[0].Quantity)
+	})
+
+	t.Run("If-Match match updates", func(t *testing.T) {
+		req, _ := http.NewRequest("PATCH", "/odata/v4/Stock('1')", strings.NewReader(`{"Quantity": 5}`))
+		req.Header.Set("If-Match", `W/"1"`)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, `W/"2"`, w.Header().Get("ETag"))
+		assert.Equal(t, 5, testStock[0].Quantity)
+	})
+
+	t.Run("Missing If-Match is required", func(t *testing.T) {
+		w := sendEntity(r, "PATCH", "/odata/v4/Stock('1')", `{"Quantity": 7}`)
+		assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+		w = sendEntity(r, "DELETE", "/odata/v4/Stock('1')", "")
+		assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+		assert.Equal(t, 5, testStock[0].Quantity)
+	})
+
+	t.Run("Change after the check is rejected by a ConditionalUpdater", func(t *testing.T) {
+		payload := &EntityPayload{EntitySet: "Stock", ID: "1", Entity: TestStock{ID: "1", Quantity: 7}, IfMatch: `W/"1"`}
+		_, err := ApplyDeepUpdate(payload)
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		assert.Equal(t, 5, testStock[0].Quantity)
+	})
+
+	t.Run("Stale If-Match on delete is rejected", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/odata/v4/Stock('1')", nil)
+		req.Header.Set("If-Match", `W/"1"`)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Len(t, testStock, 1)
+	})
+}
+
+func TestETagProviderAndMetadata(t *testing.T) {
+	assert.Equal(t, `W/"5"`, entityETag(TestVersionedNote{ID: "1", Text: "hello"}))
+	assert.Equal(t, "", entityETag(TestCategories{ID: "1"}))
+	assert.True(t, etagMatches(`W/"1", "2"`, `"2"`))
+	assert.True(t, etagMatches("*", `W/"1"`))
+
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	RegisterEntity(TestStock{}, EntityHandler{})
+	RegisterEntity(TestVersionedNote{}, EntityHandler{})
+
+	container := BuildMetadata().Schema("CatalogService").EntityContainer
+	stock := findAnnotation(container.EntitySet("Stock").Annotations, "Core.OptimisticConcurrency")
+	assert.NotNil(t, stock)
+	assert.Equal(t, []string{"Version"}, stock.Collection.PropertyPaths)
+
+	notes := findAnnotation(container.EntitySet("Notes").Annotations, "Core.OptimisticConcurrency")
+	assert.NotNil(t, notes)
+	assert.Empty(t, notes.Collection.PropertyPaths)
+}
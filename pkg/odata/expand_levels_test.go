@@ -0,0 +1,168 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestEmployees struct {
+	ID         string          `json:"ID" odata:"key"`
+	Name       string          `json:"Name"`
+	Manager_ID string          `json:"Manager_ID"`
+	Reports    []TestEmployees `json:"Reports,omitempty" odata:"expand:Reports"`
+}
+
+func (e TestEmployees) EntityName() string {
+	return "Employees"
+}
+
+func (e TestEmployees) GetRelationships() map[string]string {
+	return map[string]string{
+		"Reports": "Employees",
+	}
+}
+
+// Employees 5 and 6 manage each other to exercise cycle protection.
+var testEmployees = []TestEmployees{
+	{ID: "1", Name: "CEO"},
+	{ID: "2", Name: "CTO", Manager_ID: "1"},
+	{ID: "3", Name: "CFO", Manager_ID: "1"},
+	{ID: "4", Name: "Engineer", Manager_ID: "2"},
+	{ID: "5", Name: "Alice", Manager_ID: "6"},
+	{ID: "6", Name: "Bob", Manager_ID: "5"},
+}
+
+type TestEmployeeExpandHandler struct{}
+
+func (h TestEmployeeExpandHandler) ExpandEntity(entity OrderedFields, relationshipName string, subQuery string) interface{} {
+	var employeeID string
+	for _, field := range entity.Fields {
+		if field.Key == "ID" {
+			employeeID = field.Value.(string)
+		}
+	}
+
+	switch relationshipName {
+	case "Reports":
+		reports := []TestEmployees{}
+		for _, employee := range testEmployees {
+			if employee.Manager_ID == employeeID {
+				reports = append(reports, employee)
+			}
+		}
+		return ApplySelect(reports, subQuery)
+	}
+	return nil
+}
+
+func setupEmployeeRouter() *chi.Mux {
+	r := chi.NewRouter()
+	employeeHandler := TestEmployeeExpandHandler{}
+	RegisterEntity(TestEmployees{}, EntityHandler{
+		GetEntityByIDHandler: func(w http.ResponseWriter, r *http.Request, id string) {
+			for _, employee := range testEmployees {
+				if employee.ID == id {
+					result := ApplyExpand(employee, r.URL.RawQuery, employeeHandler)
+					CreateODataResponseSingle(w, "Employees", result)
+					return
+				}
+			}
+			http.NotFound(w, r)
+		},
+		ExpandHandler: employeeHandler,
+	})
+	RegisterEntityRelationship("Employees", "Reports", "Employees", "one-to-many")
+	RegisterRoutes(r)
+	return r
+}
+
+func getEmployee(t *testing.T, r *chi.Mux, url string) map[string]interface{} {
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	return response
+}
+
+func reportsOf(employee map[string]interface{}) []interface{} {
+	reports, _ := employee["Reports"].([]interface{})
+	return reports
+}
+
+func TestExpandLevels(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## expand_levels_test - TestExpandLevels")
+	fmt.Println("")
+	r := setupEmployeeRouter()
+
+	t.Run("Without levels only one level is expanded", func(t *testing.T) {
+		response := getEmployee(t, r, "/odata/v4/Employees(1)?$expand=Reports")
+		reports := reportsOf(response)
+		assert.Len(t, reports, 2)
+		for _, report := range reports {
+			assert.NotContains(t, report, "Reports")
+		}
+	})
+
+	t.Run("Levels limits the depth", func(t *testing.T) {
+		response := getEmployee(t, r, "/odata/v4/Employees(1)?$expand=Reports($levels=2)")
+		reports := reportsOf(response)
+		assert.Len(t, reports, 2)
+
+		cto := reports[0].(map[string]interface{})
+		assert.Equal(t, "2", cto["ID"])
+		ctoReports := reportsOf(cto)
+		assert.Len(t, ctoReports, 1)
+		assert.NotContains(t, ctoReports[0], "Reports", "Third level should not be expanded")
+	})
+
+	t.Run("Levels max expands the whole tree", func(t *testing.T) {
+		response := getEmployee(t, r, "/odata/v4/Employees(1)?$expand=Reports($levels=max)")
+		cto := reportsOf(response)[0].(map[string]interface{})
+		engineer := reportsOf(cto)[0].(map[string]interface{})
+		assert.Equal(t, "4", engineer["ID"])
+		assert.Empty(t, reportsOf(engineer))
+	})
+
+	t.Run("Levels max stops at cycles", func(t *testing.T) {
+		response := getEmployee(t, r, "/odata/v4/Employees(5)?$expand=Reports($levels=max)")
+		bob := reportsOf(response)[0].(map[string]interface{})
+		assert.Equal(t, "6", bob["ID"])
+		alice := reportsOf(bob)[0].(map[string]interface{})
+		assert.Equal(t, "5", alice["ID"])
+		assert.NotContains(t, alice, "Reports", "Cycle should not be expanded again")
+	})
+
+	t.Run("Invalid levels are rejected", func(t *testing.T) {
+		for _, levels := range []string{"0", "-2", "abc", ""} {
+			req, _ := http.NewRequest("GET", "/odata/v4/Employees(1)?$expand=Reports($levels="+levels+")", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, levels)
+		}
+		assert.Error(t, ValidateExpand("Employees", "$expand=Manager($expand=Reports($levels=0))"))
+		assert.NoError(t, ValidateExpand("Employees", "$expand=Reports($levels=max;$select=Name),Manager/$ref"))
+	})
+}
+
+func TestRecursiveRelationship(t *testing.T) {
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	RegisterEntityRelationship("Folders", "Items", "Documents", "one-to-many")
+	RegisterEntityRelationship("Documents", "Items", "Attachments", "one-to-many")
+	RegisterEntityRelationship("Folders", "Subfolders", "Folders", "one-to-many")
+
+	// Only relationships leading back to the same entity are recursive
+	assert.False(t, isRecursiveRelationship("Folders", "Items"))
+	assert.True(t, isRecursiveRelationship("Folders", "Subfolders"))
+	assert.False(t, isRecursiveRelationship("Folders", "Missing"))
+}
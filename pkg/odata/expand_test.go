@@ -23,7 +23,7 @@ func TestExpandWithSelect(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "$metadata#Products/$entity", response["@odata.context"])
+	assert.Equal(t, "/odata/v4/$metadata#Products(Category(ID))/$entity", response["@odata.context"])
 	assert.Equal(t, "1", response["ID"])
 	assert.Equal(t, "Product A", response["Name"])
 	assert.Equal(t, "Description A", response["Description"])
@@ -208,4 +208,77 @@ func TestExpand(t *testing.T) {
 			}
 		}
 	})
-}
\ No newline at end of file
+}
+func TestExpandWildcard(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## expand_test - TestExpandWildcard")
+	fmt.Println("")
+	r := setupTestRouter()
+
+	t.Run("Expand all navigation properties", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Products(1)?$expand=*", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+
+		category, ok := response["Category"].(map[string]interface{})
+		assert.True(t, ok, "Expected Category to be present and be a map")
+		assert.Equal(t, "Electronics", category["Name"])
+
+		supplier, ok := response["Supplier"].(map[string]interface{})
+		assert.True(t, ok, "Expected Supplier to be present and be a map")
+		assert.Equal(t, "Supplier A", supplier["Name"])
+	})
+
+	t.Run("Expand all navigation properties as references", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Products(1)?$expand=*/$ref", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]interface{}{"@odata.id": "Categories('1')"}, response["Category"])
+		assert.Equal(t, map[string]interface{}{"@odata.id": "Suppliers('1')"}, response["Supplier"])
+	})
+
+	t.Run("Expand collection as references", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Categories(1)?$expand=Products/$ref", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"@odata.id": "Products('1')"},
+			map[string]interface{}{"@odata.id": "Products('2')"},
+		}, response["Products"])
+	})
+
+	t.Run("Named expand takes precedence over wildcard", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Products(1)?$expand=*/$ref,Category($select=ID)", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]interface{}{"ID": "1"}, response["Category"])
+		assert.Equal(t, map[string]interface{}{"@odata.id": "Suppliers('1')"}, response["Supplier"])
+	})
+}
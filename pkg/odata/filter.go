@@ -0,0 +1,931 @@
+package odata
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ApplyFilter evaluates the $filter expression found in query against every
+// entity and returns a slice of the same type holding the matching entities.
+// Parameter aliases (@name) are resolved from the same query string, and the
+// expression may reference $it and $root/<EntitySet>(<key>)/<Property>.
+//
+// Properties tagged odata:"nofilter" cannot be used in the expression.
+//
+// A single entity that is not a slice is returned unchanged if it matches;
+// otherwise the error wraps ErrEntityNotFound, which writeHandlerError
+// answers with 404. Malformed query strings and filter expressions are
+// reported as errors.
+func ApplyFilter(entities interface{}, query string) (interface{}, error) {
+	params, err := parseQueryOptions(query)
+	if err != nil {
+		return nil, err
+	}
+	filter := params.Get("$filter")
+	if filter == "" {
+		return entities, nil
+	}
+
+	log.Printf("ApplyFilter called with filter: %s", filter)
+
+	expr, err := ParseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	slice := reflect.ValueOf(entities)
+	if entityType := reflect.TypeOf(entities); entityType != nil {
+		if slice.Kind() == reflect.Slice {
+			entityType = entityType.Elem()
+		}
+		if err := checkFilterable(expr.root, entityType, params, map[string]bool{}); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := &filterContext{aliases: params}
+
+	if slice.Kind() != reflect.Slice {
+		ctx.it = entities
+		match, err := expr.evalBool(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			return nil, fmt.Errorf("%w: entity does not match $filter", ErrEntityNotFound)
+		}
+		return entities, nil
+	}
+
+	result := reflect.MakeSlice(slice.Type(), 0, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		ctx.it = slice.Index(i).Interface()
+		match, err := expr.evalBool(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			result = reflect.Append(result, slice.Index(i))
+		}
+	}
+	return result.Interface(), nil
+}
+
+// checkFilterable reports the first property of entityType that node
+// references but that is tagged odata:"nofilter", looking into the parameter
+// aliases it uses.
+func checkFilterable(node filterNode, entityType reflect.Type, aliases url.Values, resolving map[string]bool) error {
+	switch n := node.(type) {
+	case *propertyNode:
+		if len(n.path) == 0 {
+			return nil
+		}
+		if entityType.Kind() == reflect.Ptr {
+			entityType = entityType.Elem()
+		}
+		if entityType.Kind() != reflect.Struct {
+			return nil
+		}
+		for _, property := range modelOf(entityType).Properties {
+			if strings.EqualFold(property.Name, n.path[0]) && property.tags.NoFilter {
+				return fmt.Errorf("property %s cannot be used in $filter", property.Name)
+			}
+		}
+	case *aliasNode:
+		values, ok := aliases[n.name]
+		if !ok || len(values) == 0 || resolving[n.name] {
+			return nil
+		}
+		expr, err := ParseFilter(values[0])
+		if err != nil {
+			return nil
+		}
+		resolving[n.name] = true
+		defer delete(resolving, n.name)
+		return checkFilterable(expr.root, entityType, aliases, resolving)
+	case *notNode:
+		return checkFilterable(n.operand, entityType, aliases, resolving)
+	case *binaryNode:
+		if err := checkFilterable(n.left, entityType, aliases, resolving); err != nil {
+			return err
+		}
+		return checkFilterable(n.right, entityType, aliases, resolving)
+	case *functionNode:
+		for _, arg := range n.args {
+			if err := checkFilterable(arg, entityType, aliases, resolving); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseQueryOptions parses a query string like url.ParseQuery, but accepts
+// the semicolons of values such as $format=application/json;odata.metadata=full.
+func parseQueryOptions(query string) (url.Values, error) {
+	params := url.Values{}
+	for _, option := range strings.Split(query, "&") {
+		if option == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(option, "=")
+		name, err := url.QueryUnescape(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query option %q: %w", option, err)
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query option %q: %w", option, err)
+		}
+		params.Add(name, value)
+	}
+	return params, nil
+}
+
+// ResolveParameterAlias returns the value of a parameter alias such as @p1
+// from query. Values that are not aliases are returned unchanged, which lets
+// operation handlers treat aliased and inline parameters the same way.
+func ResolveParameterAlias(query, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+	params, err := parseQueryOptions(query)
+	if err != nil {
+		return "", err
+	}
+	resolved, ok := params[value]
+	if !ok || len(resolved) == 0 {
+		return "", fmt.Errorf("parameter alias %s is not defined", value)
+	}
+	return resolved[0], nil
+}
+
+// ParseOperationParameters parses the parameter list of a function call such
+// as "(Rating=@r,Name='Bread')" into typed values, resolving parameter aliases
+// against query.
+func ParseOperationParameters(parameters, query string) (map[string]interface{}, error) {
+	parameters = strings.TrimSpace(parameters)
+	parameters = strings.TrimPrefix(parameters, "(")
+	parameters = strings.TrimSuffix(parameters, ")")
+
+	result := make(map[string]interface{})
+	if strings.TrimSpace(parameters) == "" {
+		return result, nil
+	}
+
+	aliases, err := parseQueryOptions(query)
+	if err != nil {
+		return nil, err
+	}
+	ctx := &filterContext{aliases: aliases}
+	for _, part := range splitTopLevel(parameters, ',') {
+		nameValue := strings.SplitN(part, "=", 2)
+		if len(nameValue) != 2 {
+			return nil, fmt.Errorf("invalid operation parameter: %s", part)
+		}
+		expr, err := ParseFilter(nameValue[1])
+		if err != nil {
+			return nil, err
+		}
+		value, err := expr.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result[strings.TrimSpace(nameValue[0])] = value
+	}
+	return result, nil
+}
+
+// FilterExpression is a parsed $filter expression.
+type FilterExpression struct {
+	root filterNode
+}
+
+// ParseFilter parses a $filter expression.
+func ParseFilter(filter string) (*FilterExpression, error) {
+	tokens, err := tokenizeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q in $filter", p.tokens[p.pos].text)
+	}
+	return &FilterExpression{root: node}, nil
+}
+
+func (e *FilterExpression) eval(ctx *filterContext) (interface{}, error) {
+	return e.root.eval(ctx)
+}
+
+func (e *FilterExpression) evalBool(ctx *filterContext) (bool, error) {
+	value, err := e.root.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	b, _ := value.(bool)
+	return b, nil
+}
+
+// filterContext carries the state used while evaluating an expression: the
+// current instance ($it) and the parameter aliases of the request.
+type filterContext struct {
+	it        interface{}
+	aliases   url.Values
+	resolving map[string]bool
+}
+
+type filterTokenKind int
+
+const (
+	tokenIdentifier filterTokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOpenParen
+	tokenCloseParen
+	tokenComma
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+}
+
+func tokenizeFilter(input string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{tokenOpenParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{tokenCloseParen, ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, filterToken{tokenComma, ","})
+			i++
+		case c == '\'':
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(input) {
+				if input[i] == '\'' {
+					if i+1 < len(input) && input[i+1] == '\'' {
+						sb.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				sb.WriteByte(input[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string literal in $filter")
+			}
+			tokens = append(tokens, filterToken{tokenString, sb.String()})
+		case isDigit(c) || (c == '-' && i+1 < len(input) && isDigit(input[i+1])):
+			start := i
+			i++
+			for i < len(input) && (isDigit(input[i]) || input[i] == '.' || input[i] == 'e' || input[i] == 'E') {
+				// The exponent may be signed, e.g. 1e-5
+				if (input[i] == 'e' || input[i] == 'E') && i+1 < len(input) && (input[i+1] == '+' || input[i+1] == '-') {
+					i++
+				}
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenNumber, input[start:i]})
+		case strings.HasPrefix(input[i:], "$root/"):
+			// $root paths may contain key predicates, so consume them whole
+			start := i
+			depth := 0
+			inString := false
+			for i < len(input) {
+				ch := input[i]
+				if ch == '\'' {
+					inString = !inString
+				} else if !inString {
+					if ch == '(' {
+						depth++
+					} else if ch == ')' {
+						if depth == 0 {
+							break
+						}
+						depth--
+					} else if (ch == ' ' || ch == ',') && depth == 0 {
+						break
+					}
+				}
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenIdentifier, input[start:i]})
+		case isIdentifierChar(c):
+			start := i
+			for i < len(input) && isIdentifierChar(input[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenIdentifier, input[start:i]})
+		default:
+			return nil, fmt.Errorf("unexpected character %q in $filter", c)
+		}
+	}
+	return tokens, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || c == '/' || c == '.' || isDigit(c) ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *filterParser) peekKeyword(keywords ...string) (string, bool) {
+	tok, ok := p.peek()
+	if !ok || tok.kind != tokenIdentifier {
+		return "", false
+	}
+	for _, keyword := range keywords {
+		if tok.text == keyword {
+			return keyword, true
+		}
+	}
+	return "", false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.peekKeyword("or"); !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "or", left: left, right: right}
+	}
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.peekKeyword("and"); !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "and", left: left, right: right}
+	}
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if _, ok := p.peekKeyword("not"); ok {
+		p.pos++
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.peekKeyword("eq", "ne", "gt", "ge", "lt", "le"); ok {
+		p.pos++
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAdditive() (filterNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekKeyword("add", "sub")
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *filterParser) parseMultiplicative() (filterNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekKeyword("mul", "div", "mod")
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of $filter expression")
+	}
+	p.pos++
+
+	switch tok.kind {
+	case tokenOpenParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next, ok := p.peek(); !ok || next.kind != tokenCloseParen {
+			return nil, fmt.Errorf("missing closing parenthesis in $filter")
+		}
+		p.pos++
+		return node, nil
+	case tokenString:
+		return &literalNode{value: tok.text}, nil
+	case tokenNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in $filter", tok.text)
+		}
+		return &literalNode{value: value}, nil
+	case tokenIdentifier:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if next, ok := p.peek(); ok && next.kind == tokenOpenParen {
+			return p.parseFunctionCall(tok.text)
+		}
+		switch {
+		case strings.HasPrefix(tok.text, "@"):
+			return &aliasNode{name: tok.text}, nil
+		case strings.HasPrefix(tok.text, "$root/"):
+			return &rootNode{path: strings.TrimPrefix(tok.text, "$root/")}, nil
+		case tok.text == "$it":
+			return &propertyNode{}, nil
+		case strings.HasPrefix(tok.text, "$it/"):
+			return &propertyNode{path: strings.Split(strings.TrimPrefix(tok.text, "$it/"), "/")}, nil
+		}
+		return &propertyNode{path: strings.Split(tok.text, "/")}, nil
+	}
+	return nil, fmt.Errorf("unexpected token %q in $filter", tok.text)
+}
+
+func (p *filterParser) parseFunctionCall(name string) (filterNode, error) {
+	p.pos++ // skip "("
+	node := &functionNode{name: name}
+	if next, ok := p.peek(); ok && next.kind == tokenCloseParen {
+		p.pos++
+		return node, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		node.args = append(node.args, arg)
+		next, ok := p.peek()
+		if !ok {
+			return nil, fmt.Errorf("missing closing parenthesis in call to %s", name)
+		}
+		p.pos++
+		if next.kind == tokenCloseParen {
+			return node, nil
+		}
+		if next.kind != tokenComma {
+			return nil, fmt.Errorf("unexpected token %q in call to %s", next.text, name)
+		}
+	}
+}
+
+type filterNode interface {
+	eval(ctx *filterContext) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(ctx *filterContext) (interface{}, error) {
+	return n.value, nil
+}
+
+// propertyNode reads a property path from the current instance ($it). An
+// empty path refers to the instance itself.
+type propertyNode struct {
+	path []string
+}
+
+func (n *propertyNode) eval(ctx *filterContext) (interface{}, error) {
+	return propertyPathValue(ctx.it, n.path), nil
+}
+
+type aliasNode struct {
+	name string
+}
+
+func (n *aliasNode) eval(ctx *filterContext) (interface{}, error) {
+	values, ok := ctx.aliases[n.name]
+	if !ok || len(values) == 0 {
+		return nil, fmt.Errorf("parameter alias %s is not defined", n.name)
+	}
+	if ctx.resolving[n.name] {
+		return nil, fmt.Errorf("parameter alias %s references itself", n.name)
+	}
+	expr, err := ParseFilter(values[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for parameter alias %s: %v", n.name, err)
+	}
+	if ctx.resolving == nil {
+		ctx.resolving = make(map[string]bool)
+	}
+	ctx.resolving[n.name] = true
+	defer delete(ctx.resolving, n.name)
+	return expr.eval(ctx)
+}
+
+// rootNode resolves $root/<EntitySet>(<key>)/<Property> through the
+// EntityReader registered for the entity set.
+type rootNode struct {
+	path string
+}
+
+func (n *rootNode) eval(ctx *filterContext) (interface{}, error) {
+	segments := splitTopLevel(n.path, '/')
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid $root path: %s", n.path)
+	}
+
+	entitySet, key, ok := parseKeySegment(segments[0])
+	if !ok {
+		return nil, fmt.Errorf("$root path must address a single entity: %s", n.path)
+	}
+	handler, ok := GetEntityHandler(entitySet)
+	if !ok {
+		return nil, fmt.Errorf("entity set not found: %s", entitySet)
+	}
+	if handler.EntityReader == nil {
+		return nil, fmt.Errorf("entity set %s does not support $root references", entitySet)
+	}
+	entity, found := handler.ReadEntity(key)
+	if !found {
+		return nil, nil
+	}
+	return propertyPathValue(entity, segments[1:]), nil
+}
+
+// parseKeySegment splits a segment such as Products('1') into the entity set
+// name and the key value.
+func parseKeySegment(segment string) (string, string, bool) {
+	open := strings.Index(segment, "(")
+	if open == -1 || !strings.HasSuffix(segment, ")") {
+		return segment, "", false
+	}
+	key := segment[open+1 : len(segment)-1]
+	key = strings.Trim(key, "'")
+	return segment[:open], key, true
+}
+
+type notNode struct {
+	operand filterNode
+}
+
+func (n *notNode) eval(ctx *filterContext) (interface{}, error) {
+	value, err := n.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := value.(bool)
+	return !b, nil
+}
+
+type binaryNode struct {
+	op    string
+	left  filterNode
+	right filterNode
+}
+
+func (n *binaryNode) eval(ctx *filterContext) (interface{}, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit logical operators
+	switch n.op {
+	case "and":
+		if b, _ := left.(bool); !b {
+			return false, nil
+		}
+	case "or":
+		if b, _ := left.(bool); b {
+			return true, nil
+		}
+	}
+
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	left, right = normalizeFilterValue(left), normalizeFilterValue(right)
+
+	switch n.op {
+	case "and", "or":
+		b, _ := right.(bool)
+		return b, nil
+	case "eq":
+		return compareFilterValues(left, right) == 0, nil
+	case "ne":
+		return compareFilterValues(left, right) != 0, nil
+	case "gt", "ge", "lt", "le":
+		if left == nil || right == nil {
+			return false, nil
+		}
+		cmp := compareFilterValues(left, right)
+		switch n.op {
+		case "gt":
+			return cmp > 0, nil
+		case "ge":
+			return cmp >= 0, nil
+		case "lt":
+			return cmp < 0, nil
+		default:
+			return cmp <= 0, nil
+		}
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s requires numeric operands", n.op)
+	}
+	switch n.op {
+	case "add":
+		return l + r, nil
+	case "sub":
+		return l - r, nil
+	case "mul":
+		return l * r, nil
+	case "div":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero in $filter")
+		}
+		return l / r, nil
+	case "mod":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero in $filter")
+		}
+		return math.Mod(l, r), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", n.op)
+}
+
+type functionNode struct {
+	name string
+	args []filterNode
+}
+
+func (n *functionNode) eval(ctx *filterContext) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = normalizeFilterValue(value)
+	}
+
+	stringArgs := func(count int) ([]string, error) {
+		if len(args) != count {
+			return nil, fmt.Errorf("%s expects %d arguments", n.name, count)
+		}
+		result := make([]string, count)
+		for i, arg := range args {
+			result[i] = fmt.Sprint(arg)
+		}
+		return result, nil
+	}
+
+	switch n.name {
+	case "contains", "startswith", "endswith":
+		s, err := stringArgs(2)
+		if err != nil {
+			return nil, err
+		}
+		switch n.name {
+		case "contains":
+			return strings.Contains(s[0], s[1]), nil
+		case "startswith":
+			return strings.HasPrefix(s[0], s[1]), nil
+		default:
+			return strings.HasSuffix(s[0], s[1]), nil
+		}
+	case "tolower", "toupper", "trim", "length":
+		s, err := stringArgs(1)
+		if err != nil {
+			return nil, err
+		}
+		switch n.name {
+		case "tolower":
+			return strings.ToLower(s[0]), nil
+		case "toupper":
+			return strings.ToUpper(s[0]), nil
+		case "trim":
+			return strings.TrimSpace(s[0]), nil
+		default:
+			return float64(len(s[0])), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported function %s in $filter", n.name)
+}
+
+// propertyPathValue walks path on entity, returning nil if any segment is
+// missing.
+func propertyPathValue(entity interface{}, path []string) interface{} {
+	current := entity
+	for _, segment := range path {
+		if current == nil {
+			return nil
+		}
+		fields := EntityToOrderedFields(current, segment)
+		var next interface{}
+		found := false
+		for _, field := range fields.Fields {
+			if field.Key == segment {
+				next, found = field.Value, true
+				break
+			}
+		}
+		if !found {
+			for _, field := range fields.Fields {
+				if strings.EqualFold(field.Key, segment) {
+					next, found = field.Value, true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+// normalizeFilterValue converts Go values to the small set of types the
+// evaluator works with: float64, string, bool and nil.
+func normalizeFilterValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	}
+	return v.Interface()
+}
+
+// compareFilterValues returns -1, 0 or 1. Numbers are compared numerically
+// and everything else by its string representation, so a numeric literal can
+// still be compared with a string key such as ID eq 1.
+func compareFilterValues(left, right interface{}) int {
+	if left == nil || right == nil {
+		if left == nil && right == nil {
+			return 0
+		}
+		return -1
+	}
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if lok && !rok {
+		if f, err := strconv.ParseFloat(fmt.Sprint(right), 64); err == nil {
+			r, rok = f, true
+		}
+	} else if rok && !lok {
+		if f, err := strconv.ParseFloat(fmt.Sprint(left), 64); err == nil {
+			l, lok = f, true
+		}
+	}
+	if lok && rok {
+		switch {
+		case l < r:
+			return -1
+		case l > r:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(left), fmt.Sprint(right))
+}
+
+// splitTopLevel splits s on sep, ignoring separators nested in parentheses or
+// string literals.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth := 0
+	inString := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			inString = !inString
+		case '(':
+			if !inString {
+				depth++
+			}
+		case ')':
+			if !inString {
+				depth--
+			}
+		case sep:
+			if !inString && depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		parts = append(parts, rest)
+	}
+	return parts
+}
@@ -0,0 +1,131 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProductsWithFilter(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## filter_test - TestGetProductsWithFilter")
+	fmt.Println("")
+	r := setupTestRouter()
+
+	testCases := []struct {
+		name        string
+		url         string
+		expectedIDs []string
+	}{
+		{"Comparison", "/odata/v4/Products?$filter=Price%20gt%20150", []string{"2", "3"}},
+		{"Logical operators", "/odata/v4/Products?$filter=Price%20gt%20150%20and%20not%20(Name%20eq%20'Product%20C')", []string{"2"}},
+		{"Function", "/odata/v4/Products?$filter=endswith(Name,'A')", []string{"1"}},
+		{"Parameter alias", "/odata/v4/Products?$filter=Price%20gt%20@min&@min=100", []string{"2", "3"}},
+		{"String parameter alias", "/odata/v4/Products?$filter=Name%20eq%20@name&@name='Product%20B'", []string{"2"}},
+		{"$it reference", "/odata/v4/Products?$filter=$it/Price%20le%20200", []string{"1", "2"}},
+		{"$root reference", "/odata/v4/Products?$filter=Price%20gt%20$root/Products('1')/Price", []string{"2", "3"}},
+		{"Fractional modulo", "/odata/v4/Products?$filter=Price%20mod%20150.5%20eq%2049.5", []string{"2"}},
+		{"Alias with $root", "/odata/v4/Products?$filter=Price%20eq%20@p&@p=$root/Products('2')/Price", []string{"2"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tc.url, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code, "Unexpected status code, body: %s", w.Body.String())
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			values, ok := response["value"].([]interface{})
+			assert.True(t, ok, "Expected value to be a slice, got %T", response["value"])
+
+			var ids []string
+			for _, v := range values {
+				ids = append(ids, v.(map[string]interface{})["ID"].(string))
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestGetProductsWithInvalidFilter(t *testing.T) {
+	r := setupTestRouter()
+
+	for _, url := range []string{
+		"/odata/v4/Products?$filter=Price%20gt%20@missing",
+		"/odata/v4/Products?$filter=Price%20gt%20@a&@a=@a",
+		"/odata/v4/Products?$filter=(Price%20gt%201",
+		"/odata/v4/Products?$filter=Price%20gt%20%zz",
+	} {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Expected bad request for %s", url)
+	}
+}
+
+func TestParseOperationParameters(t *testing.T) {
+	params, err := ParseOperationParameters("(Rating=@r,Name='Bread',Active=true)", "@r=5")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(5), params["Rating"])
+	assert.Equal(t, "Bread", params["Name"])
+	assert.Equal(t, true, params["Active"])
+
+	value, err := ResolveParameterAlias("@r=5", "@r")
+	assert.NoError(t, err)
+	assert.Equal(t, "5", value)
+
+	_, err = ParseOperationParameters("(Rating=@missing)", "")
+	assert.Error(t, err)
+
+	// Aliases are found next to options with semicolons, and malformed
+	// queries are reported like in ApplyFilter
+	params, err = ParseOperationParameters("(Rating=@r)", "$format=application/json;odata.metadata=full&@r=4")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(4), params["Rating"])
+	_, err = ParseOperationParameters("(Rating=@r)", "@r=%zz")
+	assert.Error(t, err)
+	_, err = ResolveParameterAlias("@r=%zz", "@r")
+	assert.Error(t, err)
+}
+
+func TestTokenizeFilterNumbers(t *testing.T) {
+	tokens, err := tokenizeFilter("Price lt 1e-5 or Price gt 2.5E+3")
+	assert.NoError(t, err)
+	var numbers []string
+	for _, token := range tokens {
+		if token.kind == tokenNumber {
+			numbers = append(numbers, token.text)
+		}
+	}
+	assert.Equal(t, []string{"1e-5", "2.5E+3"}, numbers)
+
+	filtered, err := ApplyFilter(testProducts, "$filter=Price%20gt%201e%2B2%20and%20Price%20lt%203e2")
+	assert.NoError(t, err)
+	assert.Len(t, filtered, 1)
+}
+
+func TestApplyFilterResults(t *testing.T) {
+	// A single entity that does not match is not found
+	_, err := ApplyFilter(testProducts[0], "$filter=Price%20gt%201000")
+	assert.ErrorIs(t, err, ErrEntityNotFound)
+	matched, err := ApplyFilter(testProducts[0], "$filter=Price%20lt%201000")
+	assert.NoError(t, err)
+	assert.Equal(t, testProducts[0], matched)
+
+	// Semicolons of other options do not make the query malformed
+	filtered, err := ApplyFilter(testProducts, "$format=application/json;odata.metadata=full&$filter=ID%20eq%20'1'")
+	assert.NoError(t, err)
+	assert.Len(t, filtered, 1)
+
+	_, err = ApplyFilter(testProducts, "$filter=ID%20eq%20'%zz'")
+	assert.Error(t, err)
+}
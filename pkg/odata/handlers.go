@@ -1,8 +1,12 @@
 package odata
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"reflect"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
@@ -23,6 +27,11 @@ func handleGetEntity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if token := r.URL.Query().Get("$deltatoken"); token != "" {
+		handleGetDelta(w, r, entitySet, handler, token)
+		return
+	}
+	trackChanges(w, r, entitySet, handler)
 	handler.GetEntityHandler(w, r)
 }
 
@@ -43,11 +52,471 @@ func handleGetEntityByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		w = &conditionalResponseWriter{ResponseWriter: w, ifNoneMatch: ifNoneMatch}
+	}
 	handler.GetEntityByIDHandler(w, r, id)
 }
 
+func handleCreateEntity(w http.ResponseWriter, r *http.Request) {
+	entitySet := chi.URLParam(r, "entitySet")
+	log.Printf("Handling POST request for entitySet: %s", entitySet)
+
+	handler, ok := entityHandlers[entitySet]
+	if !ok {
+		http.Error(w, "Entity set not found", http.StatusNotFound)
+		return
+	}
+
+	if handler.CreateEntityHandler != nil {
+		handler.CreateEntityHandler(w, r)
+		return
+	}
+
+	if handler.EntityCreator == nil {
+		http.Error(w, "CreateEntityHandler not implemented", http.StatusNotImplemented)
+		return
+	}
+
+	payload, err := ParseEntityPayload(r, entitySet)
+	if err != nil {
+		writeHandlerError(w, err, http.StatusBadRequest)
+		return
+	}
+	created, err := ApplyDeepInsert(payload)
+	if err != nil {
+		writeHandlerError(w, err, http.StatusInternalServerError)
+		return
+	}
+	CreateODataResponseCreated(w, entitySet, created)
+}
+
+func handleUpdateEntity(w http.ResponseWriter, r *http.Request) {
+	entitySet := chi.URLParam(r, "entitySet")
+	id := strings.Trim(chi.URLParam(r, "id"), "()'")
+	log.Printf("Handling PATCH request for entity: %s, ID: %s", entitySet, id)
+
+	handler, ok := entityHandlers[entitySet]
+	if !ok {
+		http.Error(w, "Entity set not found", http.StatusNotFound)
+		return
+	}
+
+	etag, ok := checkPreconditions(w, r, entitySet, handler, id)
+	if !ok {
+		return
+	}
+
+	if handler.UpdateEntityHandler != nil {
+		handler.UpdateEntityHandler(w, r, id)
+		return
+	}
+
+	if handler.EntityUpdater == nil || handler.EntityReader == nil {
+		http.Error(w, "UpdateEntityHandler not implemented", http.StatusNotImplemented)
+		return
+	}
+
+	payload, err := ParseEntityUpdate(r, entitySet, id)
+	if err != nil {
+		writeHandlerError(w, err, http.StatusBadRequest)
+		return
+	}
+	payload.IfMatch = etag
+	updated, err := ApplyDeepUpdate(payload)
+	if err != nil {
+		writeHandlerError(w, err, http.StatusInternalServerError)
+		return
+	}
+	CreateODataResponseSingle(w, entitySet, updated)
+}
+
+// handleUpdateCollection applies a delta payload sent with PATCH to an entity
+// set and responds with the created and updated entities.
+func handleUpdateCollection(w http.ResponseWriter, r *http.Request) {
+	entitySet := chi.URLParam(r, "entitySet")
+	log.Printf("Handling PATCH request for entitySet: %s", entitySet)
+
+	if _, ok := entityHandlers[entitySet]; !ok {
+		http.Error(w, "Entity set not found", http.StatusNotFound)
+		return
+	}
+
+	payloads, err := ParseDeltaPayload(r, entitySet)
+	if err != nil {
+		writeHandlerError(w, err, http.StatusBadRequest)
+		return
+	}
+	applied, err := ApplyDelta(payloads)
+	if err != nil {
+		writeHandlerError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("OData-Version", "4.0")
+	if preferMinimal(w) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := OrderedFields{
+		Fields: []struct{Key string; Value interface{}}{
+			{Key: "@odata.context", Value: entitySetContextURL(w, entitySet, "/$delta")},
+			{Key: "value", Value: applied},
+		},
+	}
+	encodeJSONPreserveOrder(w, response)
+}
+
+func handleDeleteEntity(w http.ResponseWriter, r *http.Request) {
+	entitySet := chi.URLParam(r, "entitySet")
+	id := strings.Trim(chi.URLParam(r, "id"), "()'")
+	log.Printf("Handling DELETE request for entity: %s, ID: %s", entitySet, id)
+
+	handler, ok := entityHandlers[entitySet]
+	if !ok {
+		http.Error(w, "Entity set not found", http.StatusNotFound)
+		return
+	}
+
+	etag, ok := checkPreconditions(w, r, entitySet, handler, id)
+	if !ok {
+		return
+	}
+
+	if handler.DeleteEntityHandler != nil {
+		handler.DeleteEntityHandler(w, r, id)
+		return
+	}
+
+	if handler.EntityDeleter == nil {
+		http.Error(w, "DeleteEntityHandler not implemented", http.StatusNotImplemented)
+		return
+	}
+
+	var err error
+	if deleter, ok := handler.EntityDeleter.(ConditionalDeleter); ok && etag != "" {
+		err = deleter.DeleteEntityIfMatch(id, etag)
+	} else {
+		err = handler.DeleteEntity(id)
+	}
+	if err != nil {
+		writeHandlerError(w, err, http.StatusInternalServerError)
+		return
+	}
+	recordChange(entitySet, id, true)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetProperty serves a property of an entity: the content of a stream
+// property, the related entities of a navigation property or the value of a
+// structural property.
+func handleGetProperty(w http.ResponseWriter, r *http.Request) {
+	entitySet := chi.URLParam(r, "entitySet")
+	id := strings.Trim(chi.URLParam(r, "id"), "()'")
+	property := chi.URLParam(r, "property")
+	if isStreamProperty(entitySet, property) {
+		handleGetStreamProperty(w, r)
+		return
+	}
+	log.Printf("Handling GET request for property: %s, ID: %s, property: %s", entitySet, id, property)
+
+	handler, ok := entityHandlers[entitySet]
+	if !ok {
+		http.Error(w, "Entity set not found", http.StatusNotFound)
+		return
+	}
+	if handler.EntityReader == nil {
+		http.Error(w, "Reading properties not implemented", http.StatusNotImplemented)
+		return
+	}
+	entity, found := handler.ReadEntity(id)
+	if !found {
+		http.Error(w, "Entity not found", http.StatusNotFound)
+		return
+	}
+	current := toOrderedFields(entity, "")
+
+	if relInfo, ok := entityRelationships[entitySet][property]; ok {
+		if handler.ExpandHandler == nil {
+			http.Error(w, "ExpandHandler not implemented", http.StatusNotImplemented)
+			return
+		}
+		// Query options apply to the related entities
+		related := handler.ExpandEntity(current, property, "")
+		targetHandler := entityHandlers[relInfo.TargetEntity]
+		if relInfo.isCollection() {
+			if related == nil {
+				related = []OrderedFields{}
+			}
+			related = ApplyExpand(related, r.URL.RawQuery, targetHandler.ExpandHandler)
+			CreateODataResponse(w, relInfo.TargetEntity, ApplySelect(related, r.URL.RawQuery))
+			return
+		}
+		if related == nil || (reflect.ValueOf(related).Kind() == reflect.Ptr && reflect.ValueOf(related).IsNil()) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		related = ApplyExpandSingle(related, r.URL.RawQuery, targetHandler.ExpandHandler)
+		CreateODataResponseSingle(w, relInfo.TargetEntity, ApplySelect(related, r.URL.RawQuery))
+		return
+	}
+
+	for _, field := range current.Fields {
+		if field.Key == property {
+			CreateODataValueResponse(w, entityReference(current)+"/"+property, field.Value)
+			return
+		}
+	}
+	http.Error(w, "Property not found", http.StatusNotFound)
+}
+
+// handleGetServiceDocument serves the service document, which lists the
+// entity sets, singletons and function imports of the entity container.
+func handleGetServiceDocument(w http.ResponseWriter, r *http.Request) {
+	var resources []OrderedFields
+	container := cachedMetadata().Schema(schemaNamespace).EntityContainer
+	if container != nil {
+		for _, entitySet := range container.EntitySets {
+			resources = append(resources, serviceDocumentResource(entitySet.Name, "EntitySet"))
+		}
+		for _, singleton := range container.Singletons {
+			resources = append(resources, serviceDocumentResource(singleton.Name, "Singleton"))
+		}
+		for _, functionImport := range container.FunctionImports {
+			if functionImport.IncludeInServiceDocument {
+				resources = append(resources, serviceDocumentResource(functionImport.Name, "FunctionImport"))
+			}
+		}
+	}
+	if resources == nil {
+		resources = []OrderedFields{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("OData-Version", "4.0")
+	response := OrderedFields{
+		Fields: []struct{Key string; Value interface{}}{
+			{Key: "@odata.context", Value: metadataURL(w)},
+			{Key: "value", Value: resources},
+		},
+	}
+	encodeJSONPreserveOrder(w, response)
+}
+
+func serviceDocumentResource(name, kind string) OrderedFields {
+	return OrderedFields{
+		Fields: []struct{Key string; Value interface{}}{
+			{Key: "name", Value: name},
+			{Key: "kind", Value: kind},
+			{Key: "url", Value: name},
+		},
+	}
+}
+
 func handleGetMetadata(w http.ResponseWriter, r *http.Request) {
-	metadata := GenerateMetadata()
-	w.Header().Set("Content-Type", "application/xml")
-	w.Write([]byte(metadata))
-}
\ No newline at end of file
+	if wantsJSONMetadata(r) {
+		w.Header().Set("OData-Version", "4.0")
+		serveMetadataDocument(w, r, cachedMetadataDocument("json"), "application/json")
+		return
+	}
+	serveMetadataDocument(w, r, cachedMetadataDocument("xml"), "application/xml")
+}
+
+// wantsJSONMetadata reports whether the metadata document was requested in
+// JSON CSDL, with $format or an Accept header that does not also accept XML.
+func wantsJSONMetadata(r *http.Request) bool {
+	if format := formatOption(r); format != "" {
+		mediaType, _, _ := strings.Cut(format, ";")
+		return mediaType == "json" || mediaType == "application/json"
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "application/xml")
+}
+
+func handleGetEntityRef(w http.ResponseWriter, r *http.Request) {
+	entitySet, id, relationshipName := refRouteParams(r)
+	log.Printf("Handling GET $ref request for entity: %s, ID: %s, relationship: %s", entitySet, id, relationshipName)
+
+	handler, relInfo, ok := lookupRelationship(w, entitySet, relationshipName)
+	if !ok {
+		return
+	}
+	if handler.EntityReader == nil || handler.ExpandHandler == nil {
+		http.Error(w, "Reading references not implemented", http.StatusNotImplemented)
+		return
+	}
+
+	entity, found := handler.ReadEntity(id)
+	if !found {
+		http.Error(w, "Entity not found", http.StatusNotFound)
+		return
+	}
+
+	result := expandReferences(toOrderedFields(entity, ""), relationshipName, handler.ExpandHandler)
+	var references interface{}
+	for _, field := range result.Fields {
+		if field.Key == relationshipName {
+			references = field.Value
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("OData-Version", "4.0")
+
+	if relInfo.isCollection() {
+		value, _ := references.([]OrderedFields)
+		if value == nil {
+			value = []OrderedFields{}
+		}
+		response := OrderedFields{
+			Fields: []struct{Key string; Value interface{}}{
+				{Key: "@odata.context", Value: contextURL(w, "Collection($ref)")},
+				{Key: "value", Value: value},
+			},
+		}
+		encodeJSONPreserveOrder(w, response)
+		return
+	}
+
+	reference, ok := references.(OrderedFields)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	contextField := struct{Key string; Value interface{}}{"@odata.context", contextURL(w, "$ref")}
+	reference.Fields = append([]struct{Key string; Value interface{}}{contextField}, reference.Fields...)
+	encodeJSONPreserveOrder(w, reference)
+}
+
+func handleCreateEntityRef(w http.ResponseWriter, r *http.Request) {
+	entitySet, id, relationshipName := refRouteParams(r)
+	log.Printf("Handling %s $ref request for entity: %s, ID: %s, relationship: %s", r.Method, entitySet, id, relationshipName)
+
+	handler, relInfo, ok := lookupRelationship(w, entitySet, relationshipName)
+	if !ok {
+		return
+	}
+	if handler.LinkHandler == nil {
+		http.Error(w, "LinkHandler not implemented", http.StatusNotImplemented)
+		return
+	}
+
+	// POST adds to a collection, PUT replaces a single-valued relationship
+	if (r.Method == http.MethodPost) != relInfo.isCollection() {
+		http.Error(w, "Method not allowed for this relationship", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	odataID, _ := body["@odata.id"].(string)
+	targetID, err := parseEntityID(odataID, relInfo.TargetEntity)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := handler.CreateLink(id, relationshipName, targetID); err != nil {
+		writeHandlerError(w, err, http.StatusInternalServerError)
+		return
+	}
+	recordLinkChange(entitySet, id, relInfo, targetID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleDeleteEntityRef(w http.ResponseWriter, r *http.Request) {
+	entitySet, id, relationshipName := refRouteParams(r)
+	log.Printf("Handling DELETE $ref request for entity: %s, ID: %s, relationship: %s", entitySet, id, relationshipName)
+
+	handler, relInfo, ok := lookupRelationship(w, entitySet, relationshipName)
+	if !ok {
+		return
+	}
+	if handler.LinkHandler == nil {
+		http.Error(w, "LinkHandler not implemented", http.StatusNotImplemented)
+		return
+	}
+
+	// Collection members are addressed either in the path or with $id
+	targetID := chi.URLParam(r, "targetID")
+	if targetID != "" {
+		targetID = strings.Trim(targetID, "'")
+	} else if odataID := r.URL.Query().Get("$id"); odataID != "" {
+		var err error
+		if targetID, err = parseEntityID(odataID, relInfo.TargetEntity); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if relInfo.isCollection() && targetID == "" {
+		http.Error(w, "The entity reference to remove must be specified", http.StatusBadRequest)
+		return
+	}
+
+	if err := handler.DeleteLink(id, relationshipName, targetID); err != nil {
+		writeHandlerError(w, err, http.StatusInternalServerError)
+		return
+	}
+	recordLinkChange(entitySet, id, relInfo, targetID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func refRouteParams(r *http.Request) (string, string, string) {
+	entitySet := chi.URLParam(r, "entitySet")
+	id := strings.Trim(chi.URLParam(r, "id"), "()'")
+	relationshipName := chi.URLParam(r, "navigation")
+	return entitySet, id, relationshipName
+}
+
+func lookupRelationship(w http.ResponseWriter, entitySet, relationshipName string) (EntityHandler, RelationshipInfo, bool) {
+	handler, ok := entityHandlers[entitySet]
+	if !ok {
+		http.Error(w, "Entity set not found", http.StatusNotFound)
+		return handler, RelationshipInfo{}, false
+	}
+	relInfo, ok := entityRelationships[entitySet][relationshipName]
+	if !ok {
+		http.Error(w, "Relationship not found", http.StatusNotFound)
+		return handler, relInfo, false
+	}
+	return handler, relInfo, true
+}
+
+// parseEntityID extracts the key from an entity id such as Products('1'),
+// ../../Products(1) or an absolute URL, checking that it addresses
+// targetEntity.
+func parseEntityID(odataID, targetEntity string) (string, error) {
+	if odataID == "" {
+		return "", fmt.Errorf("missing @odata.id")
+	}
+	segments := strings.Split(strings.TrimSuffix(odataID, "/"), "/")
+	entitySet, key, ok := parseKeySegment(segments[len(segments)-1])
+	if !ok {
+		return "", fmt.Errorf("invalid entity id: %s", odataID)
+	}
+	if entitySet != targetEntity {
+		return "", fmt.Errorf("entity id %s does not reference %s", odataID, targetEntity)
+	}
+	return key, nil
+}
+
+// writeHandlerError reports err with the status matching ErrEntityNotFound or
+// ErrNotImplemented, falling back to status for other errors.
+func writeHandlerError(w http.ResponseWriter, err error, status int) {
+	switch {
+	case errors.Is(err, ErrEntityNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrNotImplemented):
+		status = http.StatusNotImplemented
+	case errors.Is(err, ErrPreconditionFailed):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, ErrBadRequest):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
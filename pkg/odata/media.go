@@ -0,0 +1,186 @@
+package odata
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Stream is the type of a named stream property (Edm.Stream). The content is
+// served through the MediaHandler of the entity set; payloads only carry a
+// link to it and its ContentType.
+type Stream struct {
+	ContentType string
+}
+
+var streamType = reflect.TypeOf(Stream{})
+
+// MediaEntity is implemented by entity types whose instances have a media
+// resource, such as an image or a document, addressed through $value.
+type MediaEntity interface {
+	MediaContentType() string
+}
+
+func isMediaEntity(entityType Entity) bool {
+	_, ok := entityType.(MediaEntity)
+	return ok
+}
+
+// addMediaLinks completes the stream property read links of an entity
+// serialized by EntityToOrderedFields and, for media entities, adds the
+// read link and content type of the media resource.
+func addMediaLinks(result *OrderedFields, entity interface{}) {
+	var streams []int
+	for i, field := range result.Fields {
+		if strings.HasSuffix(field.Key, "@odata.mediaReadLink") {
+			streams = append(streams, i)
+		}
+	}
+	media, isMedia := entity.(MediaEntity)
+	if len(streams) == 0 && !isMedia {
+		return
+	}
+
+	reference := entityReference(*result)
+	for _, i := range streams {
+		property := strings.TrimSuffix(result.Fields[i].Key, "@odata.mediaReadLink")
+		result.Fields[i].Value = reference + "/" + property
+	}
+	if !isMedia || reference == "" {
+		return
+	}
+	mediaFields := []struct{Key string; Value interface{}}{{"@odata.mediaReadLink", reference + "/$value"}}
+	if contentType := media.MediaContentType(); contentType != "" {
+		mediaFields = append(mediaFields, struct{Key string; Value interface{}}{"@odata.mediaContentType", contentType})
+	}
+	result.Fields = append(mediaFields, result.Fields...)
+}
+
+// isStreamProperty reports whether the entity type registered for entitySet
+// has a stream property with the given name.
+func isStreamProperty(entitySet, property string) bool {
+	entityType, ok := lookupEntityType(entitySet)
+	if !ok {
+		return false
+	}
+	p, ok := modelOf(reflect.TypeOf(entityType)).Property(property)
+	return ok && p.Stream
+}
+
+func handleGetMediaValue(w http.ResponseWriter, r *http.Request) {
+	entitySet := chi.URLParam(r, "entitySet")
+	id := strings.Trim(chi.URLParam(r, "id"), "()'")
+	log.Printf("Handling GET $value request for entity: %s, ID: %s", entitySet, id)
+
+	handler, ok := lookupMediaHandler(w, entitySet, "")
+	if !ok {
+		return
+	}
+	serveMedia(w, handler, id, "")
+}
+
+func handlePutMediaValue(w http.ResponseWriter, r *http.Request) {
+	entitySet := chi.URLParam(r, "entitySet")
+	id := strings.Trim(chi.URLParam(r, "id"), "()'")
+	log.Printf("Handling PUT $value request for entity: %s, ID: %s", entitySet, id)
+
+	handler, ok := lookupMediaHandler(w, entitySet, "")
+	if !ok {
+		return
+	}
+	writeMedia(w, r, handler, id, "")
+}
+
+func handleGetStreamProperty(w http.ResponseWriter, r *http.Request) {
+	entitySet := chi.URLParam(r, "entitySet")
+	id := strings.Trim(chi.URLParam(r, "id"), "()'")
+	property := chi.URLParam(r, "property")
+	log.Printf("Handling GET stream request for entity: %s, ID: %s, property: %s", entitySet, id, property)
+
+	handler, ok := lookupMediaHandler(w, entitySet, property)
+	if !ok {
+		return
+	}
+	serveMedia(w, handler, id, property)
+}
+
+func handlePutStreamProperty(w http.ResponseWriter, r *http.Request) {
+	entitySet := chi.URLParam(r, "entitySet")
+	id := strings.Trim(chi.URLParam(r, "id"), "()'")
+	property := chi.URLParam(r, "property")
+	log.Printf("Handling PUT stream request for entity: %s, ID: %s, property: %s", entitySet, id, property)
+
+	handler, ok := lookupMediaHandler(w, entitySet, property)
+	if !ok {
+		return
+	}
+	writeMedia(w, r, handler, id, property)
+}
+
+// lookupMediaHandler returns the handler of entitySet if it serves the media
+// resource (property is empty) or the named stream property, and writes the
+// error response otherwise.
+func lookupMediaHandler(w http.ResponseWriter, entitySet, property string) (EntityHandler, bool) {
+	handler, ok := entityHandlers[entitySet]
+	if !ok {
+		http.Error(w, "Entity set not found", http.StatusNotFound)
+		return handler, false
+	}
+
+	if property == "" {
+		entityType, _ := lookupEntityType(entitySet)
+		if !isMediaEntity(entityType) {
+			http.Error(w, "Entity set is not a media entity set", http.StatusBadRequest)
+			return handler, false
+		}
+	} else if !isStreamProperty(entitySet, property) {
+		http.Error(w, "Stream property not found", http.StatusNotFound)
+		return handler, false
+	}
+
+	if handler.MediaHandler == nil {
+		http.Error(w, "MediaHandler not implemented", http.StatusNotImplemented)
+		return handler, false
+	}
+	return handler, true
+}
+
+func serveMedia(w http.ResponseWriter, handler EntityHandler, id, property string) {
+	content, contentType, err := handler.ReadMedia(id, property)
+	if err != nil {
+		writeHandlerError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if closer, ok := content.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if content == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("OData-Version", "4.0")
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("Failed to stream media of %s: %v", id, err)
+	}
+}
+
+func writeMedia(w http.ResponseWriter, r *http.Request, handler EntityHandler, id, property string) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if err := handler.WriteMedia(id, property, r.Body, contentType); err != nil {
+		writeHandlerError(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,155 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestImages struct {
+	ID        string `json:"ID" odata:"key"`
+	Title     string `json:"Title"`
+	Datasheet Stream `json:"Datasheet"`
+}
+
+func (i TestImages) EntityName() string {
+	return "Images"
+}
+
+func (i TestImages) GetRelationships() map[string]string {
+	return map[string]string{}
+}
+
+func (i TestImages) MediaContentType() string {
+	return "image/png"
+}
+
+type testMedia struct {
+	contentType string
+	content     string
+}
+
+var testImageMedia map[string]testMedia
+
+type TestImageHandler struct{}
+
+func (h TestImageHandler) ReadMedia(id, property string) (io.Reader, string, error) {
+	media, ok := testImageMedia[id+"/"+property]
+	if !ok {
+		return nil, "", ErrEntityNotFound
+	}
+	return io.NopCloser(strings.NewReader(media.content)), media.contentType, nil
+}
+
+func (h TestImageHandler) WriteMedia(id, property string, content io.Reader, contentType string) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	testImageMedia[id+"/"+property] = testMedia{contentType: contentType, content: string(data)}
+	return nil
+}
+
+func setupImageRouter() *chi.Mux {
+	testImageMedia = map[string]testMedia{
+		"1/":          {contentType: "image/png", content: "PNG"},
+		"1/Datasheet": {contentType: "application/pdf", content: "PDF"},
+	}
+
+	r := setupTestRouter()
+	images := []TestImages{{ID: "1", Title: "Logo", Datasheet: Stream{ContentType: "application/pdf"}}}
+	RegisterEntity(TestImages{}, EntityHandler{
+		GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {
+			CreateODataResponse(w, "Images", ApplySelect(images, r.URL.RawQuery))
+		},
+		MediaHandler: TestImageHandler{},
+	})
+	return r
+}
+
+func TestMediaEntity(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## media_test - TestMediaEntity")
+	fmt.Println("")
+	r := setupImageRouter()
+
+	t.Run("Media links in payload", func(t *testing.T) {
+		w := sendEntity(r, "GET", "/odata/v4/Images", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		image := response["value"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "Images('1')/$value", image["@odata.mediaReadLink"])
+		assert.Equal(t, "image/png", image["@odata.mediaContentType"])
+		assert.Equal(t, "Images('1')/Datasheet", image["Datasheet@odata.mediaReadLink"])
+		assert.Equal(t, "application/pdf", image["Datasheet@odata.mediaContentType"])
+		assert.NotContains(t, image, "Datasheet")
+	})
+
+	t.Run("Select stream property", func(t *testing.T) {
+		w := sendEntity(r, "GET", "/odata/v4/Images?$select=Datasheet", "")
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		image := response["value"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "Images('1')/Datasheet", image["Datasheet@odata.mediaReadLink"])
+		assert.NotContains(t, image, "Title")
+	})
+
+	t.Run("Read and write media resource", func(t *testing.T) {
+		w := sendEntity(r, "GET", "/odata/v4/Images('1')/$value", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Equal(t, "PNG", w.Body.String())
+
+		req, _ := http.NewRequest("PUT", "/odata/v4/Images('1')/$value", strings.NewReader("JPEG"))
+		req.Header.Set("Content-Type", "image/jpeg")
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, testMedia{contentType: "image/jpeg", content: "JPEG"}, testImageMedia["1/"])
+	})
+
+	t.Run("Read and write stream property", func(t *testing.T) {
+		w := sendEntity(r, "GET", "/odata/v4/Images/1/Datasheet", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+		assert.Equal(t, "PDF", w.Body.String())
+
+		w = sendEntity(r, "PUT", "/odata/v4/Images('1')/Datasheet", "PDF v2")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "PDF v2", testImageMedia["1/Datasheet"].content)
+		assert.Equal(t, "application/octet-stream", testImageMedia["1/Datasheet"].contentType)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		w := sendEntity(r, "GET", "/odata/v4/Images('2')/$value", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = sendEntity(r, "PUT", "/odata/v4/Images('1')/Title", "text")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = sendEntity(r, "GET", "/odata/v4/Products('1')/$value", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestMediaMetadata(t *testing.T) {
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	RegisterEntity(TestImages{}, EntityHandler{})
+
+	images := BuildMetadata().Schema("CatalogService").EntityType("Images")
+	assert.True(t, images.HasStream)
+	assert.Equal(t, "Edm.Stream", images.Property("Datasheet").Type)
+}
@@ -1,151 +1,189 @@
 package odata
 
 import (
+	"encoding/xml"
+	"log"
 	"reflect"
-	"strings"
+	"sort"
 )
 
+// schemaNamespace is the namespace of the entity types and the container.
+const schemaNamespace = "CatalogService"
+
+var metadataCustomizers []func(*Edmx)
+
+// RegisterMetadataCustomizer registers a function that modifies the metadata
+// document built by BuildMetadata before it is served, e.g. to add
+// annotations the registry cannot express.
+func RegisterMetadataCustomizer(customize func(*Edmx)) {
+	metadataCustomizers = append(metadataCustomizers, customize)
+	invalidateMetadata()
+}
+
+// GenerateMetadata returns the CSDL XML metadata document of the registered
+// entities.
 func GenerateMetadata() string {
-	edm := `<edmx:Edmx Version="4.0" xmlns:edmx="http://docs.oasis-open.org/odata/ns/edmx">
-        <edmx:Reference Uri="https://sap.github.io/odata-vocabularies/vocabularies/Common.xml">
-            <edmx:Include Alias="Common" Namespace="com.sap.vocabularies.Common.v1"/>
-        </edmx:Reference>
-        <edmx:Reference Uri="https://oasis-tcs.github.io/odata-vocabularies/vocabularies/Org.OData.Core.V1.xml">
-            <edmx:Include Alias="Core" Namespace="Org.OData.Core.V1"/>
-        </edmx:Reference>
-        <edmx:DataServices>
-            <Schema xmlns="http://docs.oasis-open.org/odata/ns/edm" Namespace="CatalogService">
-                <EntityContainer Name="EntityContainer">`
+	edm, err := xml.MarshalIndent(BuildMetadata(), "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode metadata: %v", err)
+		return ""
+	}
+	return xml.Header + string(edm)
+}
 
+// BuildMetadata builds the EDM model of the registered entities and applies
+// the registered metadata customizers to it.
+func BuildMetadata() *Edmx {
+	schema := &EdmSchema{
+		Xmlns:           "http://docs.oasis-open.org/odata/ns/edm",
+		Namespace:       schemaNamespace,
+		EntityContainer: &EdmEntityContainer{Name: "EntityContainer"},
+	}
 	for _, entityType := range entityTypes {
-		entitySetName := entityType.EntityName()
-		edm += `<EntitySet Name="` + entitySetName + `" EntityType="CatalogService.` + entitySetName + `">`
-		relationships := entityRelationships[entitySetName]
-		for relationshipName, relInfo := range relationships {
-			edm += `<NavigationPropertyBinding Path="` + relationshipName + `" Target="` + relInfo.TargetEntity + `"/>`
-		}
-		edm += `</EntitySet>`
+		schema.EntityContainer.EntitySets = append(schema.EntityContainer.EntitySets, buildEntitySet(entityType))
+	}
+	for _, entityType := range entityTypes {
+		schema.EntityTypes = append(schema.EntityTypes, buildEntityType(entityType))
 	}
+	schema.Annotations = buildVocabularyAnnotations()
+
+	edmx := &Edmx{
+		Version:   "4.0",
+		XmlnsEdmx: "http://docs.oasis-open.org/odata/ns/edmx",
+		References: []*EdmReference{
+			{
+				URI:      "https://sap.github.io/odata-vocabularies/vocabularies/Common.xml",
+				Includes: []*EdmInclude{{Alias: "Common", Namespace: "com.sap.vocabularies.Common.v1"}},
+			},
+			{
+				URI:      "https://sap.github.io/odata-vocabularies/vocabularies/UI.xml",
+				Includes: []*EdmInclude{{Alias: "UI", Namespace: "com.sap.vocabularies.UI.v1"}},
+			},
+			{
+				URI:      "https://oasis-tcs.github.io/odata-vocabularies/vocabularies/Org.OData.Core.V1.xml",
+				Includes: []*EdmInclude{{Alias: "Core", Namespace: "Org.OData.Core.V1"}},
+			},
+			{
+				URI:      "https://oasis-tcs.github.io/odata-vocabularies/vocabularies/Org.OData.Capabilities.V1.xml",
+				Includes: []*EdmInclude{{Alias: "Capabilities", Namespace: "Org.OData.Capabilities.V1"}},
+			},
+		},
+		DataServices: EdmDataServices{Schemas: []*EdmSchema{schema}},
+	}
+	for _, customize := range metadataCustomizers {
+		customize(edmx)
+	}
+	return edmx
+}
 
-	edm += `</EntityContainer>`
+func buildEntitySet(entityType Entity) *EdmEntitySet {
+	entitySetName := entityType.EntityName()
+	entitySet := &EdmEntitySet{
+		Name:       entitySetName,
+		EntityType: schemaNamespace + "." + entitySetName,
+	}
 
-	for _, entityType := range entityTypes {
-		edm += generateEntityTypeMetadata(entityType)
+	relationships := entityRelationships[entitySetName]
+	relationshipNames := make([]string, 0, len(relationships))
+	for relationshipName := range relationships {
+		relationshipNames = append(relationshipNames, relationshipName)
+	}
+	sort.Strings(relationshipNames)
+	for _, relationshipName := range relationshipNames {
+		entitySet.NavigationPropertyBindings = append(entitySet.NavigationPropertyBindings, &EdmNavigationPropertyBinding{
+			Path:   relationshipName,
+			Target: relationships[relationshipName].TargetEntity,
+		})
 	}
 
-	edm += `</Schema>
-        </edmx:DataServices>
-    </edmx:Edmx>`
-	return edm
+	entitySet.Annotations = capabilityAnnotations(entityType, entityHandlers[entitySetName])
+	if hasOptimisticConcurrency(entityType) {
+		entitySet.Annotations = append(entitySet.Annotations, &EdmAnnotation{
+			Term:          "Core.OptimisticConcurrency",
+			EdmExpression: EdmExpression{Collection: &EdmCollection{PropertyPaths: modelOf(reflect.TypeOf(entityType)).ETags}},
+		})
+	}
+	return entitySet
 }
 
-func generateEntityTypeMetadata(entityType Entity) string {
+func buildEntityType(entityType Entity) *EdmEntityType {
 	entityTypeValue := reflect.TypeOf(entityType)
 	entityTypeName := entityType.EntityName()
-	entityMetadata := `<EntityType Name="` + entityTypeName + `">`
-
-	// Add Key
-	entityMetadata += `<Key>`
-	for i := 0; i < entityTypeValue.NumField(); i++ {
-		field := entityTypeValue.Field(i)
-		if hasODataTag(field, "key") {
-			entityMetadata += `<PropertyRef Name="` + field.Name + `"/>`
+	result := &EdmEntityType{Name: entityTypeName, HasStream: isMediaEntity(entityType)}
+
+	model := modelOf(entityTypeValue)
+	if len(model.Keys) > 0 {
+		result.Key = &EdmKey{}
+		for _, key := range model.Keys {
+			result.Key.PropertyRefs = append(result.Key.PropertyRefs, &EdmPropertyRef{Name: key})
 		}
 	}
-	entityMetadata += `</Key>`
 
-	// Add Properties and Navigation Properties
-	for i := 0; i < entityTypeValue.NumField(); i++ {
-		field := entityTypeValue.Field(i)
-		if isNavigationProperty(field) {
-			entityMetadata += generateNavigationPropertyMetadata(field, entityTypeName, entityTypeValue)
+	for _, property := range model.Properties {
+		if property.Navigation {
+			if navigationProperty := buildNavigationProperty(property, entityTypeName); navigationProperty != nil {
+				result.NavigationProperties = append(result.NavigationProperties, navigationProperty)
+			}
 		} else {
-			entityMetadata += generatePropertyMetadata(field)
+			result.Properties = append(result.Properties, buildProperty(property))
 		}
 	}
-
-	entityMetadata += `</EntityType>`
-	return entityMetadata
+	return result
 }
 
-func generatePropertyMetadata(field reflect.StructField) string {
-	edmType := mapGoTypeToEdmType(field.Type)
-	
-	// Set nullable to true by default
-	nullable := "true"
-	
-	// Check if the field is a key or explicitly set as not null
-	if hasODataTag(field, "key") || hasODataTag(field, "notnull") {
-		nullable = "false"
-	}
-
-	metadata := `<Property Name="` + field.Name + `" Type="Edm.` + edmType + `"`
-	
-	// Only add Nullable attribute if it's false
-	if nullable == "false" {
-		metadata += ` Nullable="false"`
-	}
-
-	// Handle OData tags
-	oDataTags := getODataTags(field)
-	for key, value := range oDataTags {
-		switch key {
-		case "maxlength":
-			metadata += ` MaxLength="` + value + `"`
-		case "precision":
-			metadata += ` Precision="` + value + `"`
-		case "scale":
-			metadata += ` Scale="` + value + `"`
-		}
+func buildProperty(property *PropertyModel) *EdmProperty {
+	result := &EdmProperty{
+		Name:      property.Name,
+		Type:      "Edm." + property.EdmType,
+		MaxLength: property.tags.MaxLength,
+		Precision: property.tags.Precision,
+		Scale:     property.tags.Scale,
 	}
-
-	metadata += "/>"
-	return metadata
+	// Properties are nullable unless they are keys or tagged notnull
+	if property.tags.Key || property.tags.NotNull {
+		result.Nullable = "false"
+	}
+	return result
 }
 
-func generateNavigationPropertyMetadata(field reflect.StructField, parentTypeName string, parentType reflect.Type) string {
+func buildNavigationProperty(property *PropertyModel, parentTypeName string) *EdmNavigationProperty {
 	relationships := entityRelationships[parentTypeName]
-	relInfo, exists := relationships[field.Name]
+	navigationName := property.Name
+	relInfo, exists := relationships[navigationName]
 	if !exists {
-		return ""
+		return nil
 	}
 
-	metadata := `<NavigationProperty Name="` + field.Name + `" Type="`
-	if relInfo.Type == "one-to-many" {
-		metadata += `Collection(CatalogService.` + relInfo.TargetEntity + `)`
+	result := &EdmNavigationProperty{Name: navigationName}
+	if relInfo.isCollection() {
+		result.Type = `Collection(` + schemaNamespace + `.` + relInfo.TargetEntity + `)`
+	} else if relInfo.Multiplicity == MultiplicityOne {
+		result.Type = schemaNamespace + `.` + relInfo.TargetEntity
+		result.Nullable = "false"
 	} else {
-		metadata += `CatalogService.` + relInfo.TargetEntity
-	}
-	metadata += `"`
-
-	// Add Partner if it exists
-	partnerFound := false
-	for _, partnerRelationships := range entityRelationships {
-		for partnerRelationship, partnerRelInfo := range partnerRelationships {
-			if partnerRelInfo.TargetEntity == parentTypeName {
-				metadata += ` Partner="` + partnerRelationship + `"`
-				partnerFound = true
-				break
-			}
-		}
-		if partnerFound {
-			break
-		}
+		result.Type = schemaNamespace + `.` + relInfo.TargetEntity
 	}
-
-	metadata += ">"
-
-	// Add ReferentialConstraint
-	refConstraintField := field.Name + "_ID"
-	if _, ok := parentType.FieldByName(refConstraintField); ok {
-		metadata += `<ReferentialConstraint Property="` + refConstraintField + `" ReferencedProperty="ID"/>`
+	if partner, ok := relationshipPartner(parentTypeName, navigationName); ok {
+		result.Partner = partner
 	}
-
-	metadata += `</NavigationProperty>`
-	return metadata
+	foreignKey, hasForeignKey := relationshipForeignKey(parentTypeName, navigationName)
+	referencedProperty, hasReferencedProperty := relationshipReferencedProperty(relInfo)
+	if hasForeignKey && hasReferencedProperty {
+		result.ReferentialConstraints = append(result.ReferentialConstraints, &EdmReferentialConstraint{
+			Property:           foreignKey,
+			ReferencedProperty: referencedProperty,
+		})
+	}
+	if relInfo.OnDelete != "" {
+		result.OnDelete = &EdmOnDelete{Action: relInfo.OnDelete}
+	}
+	return result
 }
 
 func mapGoTypeToEdmType(t reflect.Type) string {
+	if t == streamType {
+		return "Stream"
+	}
 	switch t.Kind() {
 	case reflect.String:
 		return "String"
@@ -167,24 +205,3 @@ func isNullable(t reflect.Type) bool {
 func isNavigationProperty(field reflect.StructField) bool {
 	return field.Type.Kind() == reflect.Ptr || field.Type.Kind() == reflect.Slice
 }
-
-func hasODataTag(field reflect.StructField, tag string) bool {
-	oDataTag := field.Tag.Get("odata")
-	return strings.Contains(oDataTag, tag)
-}
-
-func getODataTags(field reflect.StructField) map[string]string {
-	tags := make(map[string]string)
-	oDataTag := field.Tag.Get("odata")
-	if oDataTag == "" {
-		return tags
-	}
-
-	for _, tag := range strings.Split(oDataTag, ",") {
-		parts := strings.SplitN(tag, ":", 2)
-		if len(parts) == 2 {
-			tags[strings.ToLower(parts[0])] = parts[1]
-		}
-	}
-	return tags
-}
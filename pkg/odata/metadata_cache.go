@@ -0,0 +1,135 @@
+package odata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetadataCacheControl is the Cache-Control header of the metadata document.
+// The default lets clients keep the document but revalidate it with
+// If-None-Match on every use, which answers 304 while it is unchanged.
+var MetadataCacheControl = "no-cache"
+
+// metadataDocument is a serialized metadata document with its ETag and its
+// gzip encoded form.
+type metadataDocument struct {
+	content     []byte
+	gzipped     []byte
+	etag        string
+	gzippedETag string
+}
+
+// metadataCache holds the metadata model and documents until the registry
+// changes. Registration functions call invalidateMetadata.
+var metadataCache struct {
+	sync.Mutex
+	edmx      *Edmx
+	documents map[string]*metadataDocument
+}
+
+func invalidateMetadata() {
+	metadataCache.Lock()
+	defer metadataCache.Unlock()
+	metadataCache.edmx = nil
+	metadataCache.documents = nil
+}
+
+// cachedMetadata returns the metadata model built by BuildMetadata. It is
+// shared and must not be modified.
+func cachedMetadata() *Edmx {
+	metadataCache.Lock()
+	defer metadataCache.Unlock()
+	if metadataCache.edmx == nil {
+		metadataCache.edmx = BuildMetadata()
+	}
+	return metadataCache.edmx
+}
+
+// cachedMetadataDocument returns the metadata document in format, "xml" or
+// "json", generating it on first use.
+func cachedMetadataDocument(format string) *metadataDocument {
+	metadataCache.Lock()
+	defer metadataCache.Unlock()
+	if doc, ok := metadataCache.documents[format]; ok {
+		return doc
+	}
+
+	var content string
+	if format == "json" {
+		content = GenerateMetadataJSON()
+	} else {
+		content = GenerateMetadata()
+	}
+	doc := newMetadataDocument([]byte(content))
+	if metadataCache.documents == nil {
+		metadataCache.documents = make(map[string]*metadataDocument)
+	}
+	metadataCache.documents[format] = doc
+	return doc
+}
+
+func newMetadataDocument(content []byte) *metadataDocument {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:16])
+
+	var gzipped bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&gzipped, gzip.BestCompression)
+	gz.Write(content)
+	gz.Close()
+
+	// The gzip encoded document is a different representation and needs an
+	// entity tag of its own
+	return &metadataDocument{
+		content:     content,
+		gzipped:     gzipped.Bytes(),
+		etag:        `"` + hash + `"`,
+		gzippedETag: `"` + hash + `-gzip"`,
+	}
+}
+
+// serveMetadataDocument writes doc, gzip encoded if the client accepts it,
+// or 304 Not Modified if the client already has it.
+func serveMetadataDocument(w http.ResponseWriter, r *http.Request, doc *metadataDocument, contentType string) {
+	content, etag := doc.content, doc.etag
+	gzipped := acceptsGzip(r)
+	if gzipped {
+		content, etag = doc.gzipped, doc.gzippedETag
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", MetadataCacheControl)
+	w.Header().Add("Vary", "Accept, Accept-Encoding")
+	if ifNoneMatch := r.Header.Get("If-None-Match"); etagMatches(ifNoneMatch, doc.etag) || etagMatches(ifNoneMatch, doc.gzippedETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if gzipped {
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	w.Write(content)
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		if name = strings.TrimSpace(name); name != "gzip" && name != "*" {
+			continue
+		}
+		// q=0 explicitly refuses the coding
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -1,7 +1,14 @@
 package odata
 
 import (
+	"compress/gzip"
+	"encoding/json"
 	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -125,7 +132,7 @@ func TestGenerateMetadata(t *testing.T) {
 	assert.Len(t, edmx.DataServices.Schema.EntityTypes, 2)
 	for _, entityType := range edmx.DataServices.Schema.EntityTypes {
 		assert.Contains(t, []string{"Products", "Categories"}, entityType.Name)
-		assert.Equal(t, "ID", entityType.Key.PropertyRef.Name)
+		assert.Equal(t, "id", entityType.Key.PropertyRef.Name)
 
 		if entityType.Name == "TestProducts" {
 			assert.Len(t, entityType.Properties, 5)
@@ -164,6 +171,277 @@ func TestGenerateMetadata(t *testing.T) {
 	}
 }
 
+func TestMetadataIsWellFormed(t *testing.T) {
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	metadataCustomizers = nil
+	defer func() { metadataCustomizers = nil }()
+
+	RegisterEntity(TestEntity{}, EntityHandler{})
+	RegisterMetadataCustomizer(func(edmx *Edmx) {
+		products := edmx.Schema("CatalogService").EntityType("Products")
+		products.Property("name").Annotations = append(products.Property("name").Annotations, &EdmAnnotation{
+			Term:          "Core.Description",
+			EdmExpression: EdmExpression{String: `Name of the "product" <shown> & sorted`},
+		})
+	})
+
+	var edmx struct {
+		DataServices struct {
+			Schema struct {
+				EntityTypes []struct {
+					Name       string `xml:"Name,attr"`
+					Properties []struct {
+						Name        string `xml:"Name,attr"`
+						Annotations []struct {
+							Term   string `xml:"Term,attr"`
+							String string `xml:"String,attr"`
+						} `xml:"Annotation"`
+					} `xml:"Property"`
+				} `xml:"EntityType"`
+			} `xml:"Schema"`
+		} `xml:"DataServices"`
+	}
+	err := xml.Unmarshal([]byte(GenerateMetadata()), &edmx)
+	assert.NoError(t, err)
+
+	name := edmx.DataServices.Schema.EntityTypes[0].Properties[1]
+	assert.Equal(t, "name", name.Name)
+	assert.Equal(t, "Core.Description", name.Annotations[0].Term)
+	assert.Equal(t, `Name of the "product" <shown> & sorted`, name.Annotations[0].String)
+}
+
+func TestRelationshipOptions(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## metadata_test - TestRelationshipOptions")
+	fmt.Println("")
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	setupTestRouter()
+
+	// A second relationship from Categories to Products makes the partner of
+	// Products.Category ambiguous
+	RegisterEntityRelationship("Categories", "Featured", "Products", "one-to-many")
+	products := BuildMetadata().Schema("CatalogService").EntityType("Products")
+	assert.Equal(t, "", products.NavigationProperty("Category").Partner)
+	assert.Equal(t, "Products", products.NavigationProperty("Supplier").Partner)
+
+	RegisterEntityRelationshipWithOptions("Products", "Category", "Categories", "one-to-one", RelationshipOptions{
+		Partner:            "Products",
+		ForeignKey:         "Category_ID",
+		ReferencedProperty: "ID",
+		Multiplicity:       MultiplicityOne,
+	})
+	RegisterEntityRelationshipWithOptions("Categories", "Products", "Products", "one-to-many", RelationshipOptions{
+		Partner:  "Category",
+		OnDelete: OnDeleteCascade,
+	})
+	schema := BuildMetadata().Schema("CatalogService")
+	category := schema.EntityType("Products").NavigationProperty("Category")
+	assert.Equal(t, "Products", category.Partner)
+	assert.Equal(t, "false", category.Nullable)
+	assert.Equal(t, []*EdmReferentialConstraint{{Property: "Category_ID", ReferencedProperty: "ID"}}, category.ReferentialConstraints)
+	categoryProducts := schema.EntityType("Categories").NavigationProperty("Products")
+	assert.Equal(t, "Category", categoryProducts.Partner)
+	assert.Equal(t, &EdmOnDelete{Action: "Cascade"}, categoryProducts.OnDelete)
+	foreignKey, _ := partnerForeignKey("Categories", "Products")
+	assert.Equal(t, "Category_ID", foreignKey)
+
+	assert.Contains(t, GenerateMetadata(), `<OnDelete Action="Cascade"></OnDelete>`)
+	var csdl struct {
+		CatalogService map[string]map[string]interface{}
+	}
+	err := json.Unmarshal([]byte(GenerateMetadataJSON()), &csdl)
+	assert.NoError(t, err)
+	assert.Equal(t, "Cascade", csdl.CatalogService["Categories"]["Products"].(map[string]interface{})["$OnDelete"])
+	assert.NotContains(t, csdl.CatalogService["Products"]["Category"], "$Nullable")
+
+	// Declared foreign keys are used without the naming convention
+	RegisterEntityRelationshipWithOptions("Products", "Maker", "Suppliers", "one-to-one", RelationshipOptions{ForeignKey: "Supplier_ID"})
+	foreignKey, _ = relationshipForeignKey("Products", "Maker")
+	assert.Equal(t, "Supplier_ID", foreignKey)
+	_, ok := relationshipForeignKey("Products", "Owner")
+	assert.False(t, ok)
+}
+
+func TestMetadataJSON(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## metadata_test - TestMetadataJSON")
+	fmt.Println("")
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	r := setupTestRouter()
+	RegisterEntity(TestStock{}, EntityHandler{})
+
+	get := func(url, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", url, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		return w
+	}
+
+	assert.Equal(t, "application/xml", get("/odata/v4/$metadata", "").Header().Get("Content-Type"))
+	assert.Equal(t, "application/xml", get("/odata/v4/$metadata", "application/xml, application/json").Header().Get("Content-Type"))
+	assert.Equal(t, "application/json", get("/odata/v4/$metadata", "application/json").Header().Get("Content-Type"))
+
+	w := get("/odata/v4/$metadata?$format=json", "")
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, GenerateMetadataJSON(), w.Body.String())
+
+	var csdl map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &csdl)
+	assert.NoError(t, err)
+	assert.Equal(t, "4.0", csdl["$Version"])
+	assert.Equal(t, "CatalogService.EntityContainer", csdl["$EntityContainer"])
+	assert.Contains(t, csdl["$Reference"], "https://oasis-tcs.github.io/odata-vocabularies/vocabularies/Org.OData.Core.V1.xml")
+
+	schema := csdl["CatalogService"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"$Kind":        "EntityType",
+		"$Key":         []interface{}{"ID"},
+		"ID":           map[string]interface{}{},
+		"Name":         map[string]interface{}{"$Nullable": true},
+		"Description":  map[string]interface{}{"$Nullable": true},
+		"Price":        map[string]interface{}{"$Type": "Edm.Decimal", "$Nullable": true},
+		"Category_ID":  map[string]interface{}{"$Nullable": true},
+		"Supplier_ID":  map[string]interface{}{"$Nullable": true},
+		"Category": map[string]interface{}{
+			"$Kind":                  "NavigationProperty",
+			"$Type":                  "CatalogService.Categories",
+			"$Nullable":              true,
+			"$Partner":               "Products",
+			"$ReferentialConstraint": map[string]interface{}{"Category_ID": "ID"},
+		},
+		"Supplier": map[string]interface{}{
+			"$Kind":                  "NavigationProperty",
+			"$Type":                  "CatalogService.Suppliers",
+			"$Nullable":              true,
+			"$Partner":               "Products",
+			"$ReferentialConstraint": map[string]interface{}{"Supplier_ID": "ID"},
+		},
+	}, schema["Products"])
+
+	categories := schema["Categories"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"$Kind":       "NavigationProperty",
+		"$Collection": true,
+		"$Type":       "CatalogService.Products",
+		"$Partner":    "Category",
+	}, categories["Products"])
+
+	container := schema["EntityContainer"].(map[string]interface{})
+	assert.Equal(t, "EntityContainer", container["$Kind"])
+	assert.Equal(t, map[string]interface{}{
+		"$Collection":                true,
+		"$Type":                      "CatalogService.Products",
+		"$NavigationPropertyBinding": map[string]interface{}{"Category": "Categories", "Supplier": "Suppliers"},
+		"@Capabilities.UpdateRestrictions": map[string]interface{}{"Updatable": false},
+		"@Capabilities.DeleteRestrictions": map[string]interface{}{"Deletable": false},
+	}, container["Products"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"$PropertyPath": "Version"}}, container["Stock"].(map[string]interface{})["@Core.OptimisticConcurrency"])
+
+	// Members keep the order of the XML document
+	assert.Less(t, strings.Index(w.Body.String(), `"Products"`), strings.Index(w.Body.String(), `"Categories"`))
+}
+
+func TestMetadataCaching(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## metadata_test - TestMetadataCaching")
+	fmt.Println("")
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	r := setupTestRouter()
+
+	get := func(url string, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", url, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/odata/v4/$metadata", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.Equal(t, GenerateMetadata(), w.Body.String())
+	assert.Same(t, cachedMetadataDocument("xml"), cachedMetadataDocument("xml"))
+
+	t.Run("Conditional GET", func(t *testing.T) {
+		w := get("/odata/v4/$metadata", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		assert.Empty(t, w.Body.String())
+
+		w = get("/odata/v4/$metadata", map[string]string{"If-None-Match": `"outdated"`})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Gzip", func(t *testing.T) {
+		w := get("/odata/v4/$metadata", map[string]string{"Accept-Encoding": "br, gzip"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+		reader, err := gzip.NewReader(w.Body)
+		assert.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, GenerateMetadata(), string(content))
+
+		w = get("/odata/v4/$metadata", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		w = get("/odata/v4/$metadata", map[string]string{"Accept-Encoding": "gzip;q=0"})
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+	})
+
+	t.Run("Formats are cached separately", func(t *testing.T) {
+		w := get("/odata/v4/$metadata?$format=json", nil)
+		assert.Equal(t, GenerateMetadataJSON(), w.Body.String())
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	})
+
+	t.Run("Registration invalidates the cache", func(t *testing.T) {
+		RegisterEntity(TestStock{}, EntityHandler{})
+		w := get("/odata/v4/$metadata", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+		assert.Contains(t, w.Body.String(), `<EntityType Name="Stock">`)
+	})
+}
+
+func TestAnnotationExpressionsJSON(t *testing.T) {
+	annotation := &EdmAnnotation{
+		Term:      "UI.LineItem",
+		Qualifier: "Short",
+		EdmExpression: EdmExpression{Collection: &EdmCollection{Records: []*EdmRecord{{
+			Type: "UI.DataField",
+			PropertyValues: []*EdmPropertyValue{
+				{Property: "Value", EdmExpression: EdmExpression{Path: "Name"}},
+				{Property: "Importance", EdmExpression: EdmExpression{EnumMember: "UI.ImportanceType/High"}},
+				{Property: "Position", EdmExpression: EdmExpression{Int: "10"}},
+			},
+		}}}},
+	}
+	var member OrderedFields
+	addCSDLAnnotations(&member, []*EdmAnnotation{annotation, {Term: "Core.Computed"}})
+
+	data, err := json.Marshal(member)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"@UI.LineItem#Short": [{"@type": "#UI.DataField", "Value": {"$Path": "Name"}, "Importance": "High", "Position": 10}],
+		"@Core.Computed": true
+	}`, string(data))
+}
+
 func findProperty(properties []struct {
 	Name string `xml:"Name,attr"`
 	Type string `xml:"Type,attr"`
@@ -0,0 +1,113 @@
+package odata
+
+import (
+	"reflect"
+	"sync"
+)
+
+// EntityModel describes how a Go struct type is exposed as an OData entity
+// type. It is derived from the struct fields and their json and odata tags
+// once, when the type is registered or first serialized, and must not be
+// modified.
+type EntityModel struct {
+	// Name is the entity set name returned by EntityName, or empty for types
+	// that do not implement Entity.
+	Name string
+	Type reflect.Type
+	// Properties are the exposed fields in declaration order, structural
+	// and navigation properties alike.
+	Properties []*PropertyModel
+	// Keys and ETags are the names of the key and etag properties.
+	Keys  []string
+	ETags []string
+
+	properties map[string]*PropertyModel
+}
+
+// PropertyModel describes a struct field exposed as an OData property.
+type PropertyModel struct {
+	// Name is the OData property name, JSONName the name encoding/json uses.
+	Name     string
+	JSONName string
+	Field    reflect.StructField
+	// EdmType is the primitive type of structural properties, e.g. "String".
+	EdmType    string
+	Navigation bool
+	Stream     bool
+
+	tags fieldTag
+}
+
+// Value returns the value of the property on entity, a struct value of the
+// model's type.
+func (p *PropertyModel) Value(entity reflect.Value) reflect.Value {
+	return entity.FieldByIndex(p.Field.Index)
+}
+
+// Property returns the property with the given OData name.
+func (m *EntityModel) Property(name string) (*PropertyModel, bool) {
+	p, ok := m.properties[name]
+	return p, ok
+}
+
+var entityModels sync.Map
+
+// modelOf returns the model of the struct type typ, or of the struct typ
+// points to, building and caching it on first use.
+func modelOf(typ reflect.Type) *EntityModel {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if model, ok := entityModels.Load(typ); ok {
+		return model.(*EntityModel)
+	}
+	model, _ := entityModels.LoadOrStore(typ, newEntityModel(typ))
+	return model.(*EntityModel)
+}
+
+func newEntityModel(typ reflect.Type) *EntityModel {
+	model := &EntityModel{Type: typ, properties: make(map[string]*PropertyModel)}
+	if entity, ok := reflect.Zero(typ).Interface().(Entity); ok {
+		model.Name = entity.EntityName()
+	}
+	if typ.Kind() != reflect.Struct {
+		return model
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !isProperty(field) {
+			continue
+		}
+		p := &PropertyModel{
+			Name:       propertyName(field),
+			JSONName:   jsonName(field),
+			Field:      field,
+			Navigation: isNavigationProperty(field),
+			Stream:     field.Type == streamType,
+			tags:       fieldTags(field),
+		}
+		if !p.Navigation {
+			p.EdmType = mapGoTypeToEdmType(field.Type)
+		}
+		if p.tags.Key {
+			model.Keys = append(model.Keys, p.Name)
+		}
+		if p.tags.ETag {
+			model.ETags = append(model.ETags, p.Name)
+		}
+		model.Properties = append(model.Properties, p)
+		model.properties[p.Name] = p
+	}
+	return model
+}
+
+// LookupEntityModel returns the model of the entity type registered for
+// entitySet.
+func LookupEntityModel(entitySet string) (*EntityModel, bool) {
+	entityType, ok := lookupEntityType(entitySet)
+	if !ok {
+		return nil, false
+	}
+	return modelOf(reflect.TypeOf(entityType)), true
+}
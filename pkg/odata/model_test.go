@@ -0,0 +1,91 @@
+package odata
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntityModel(t *testing.T) {
+	setupTestRouter()
+	model, ok := LookupEntityModel("Products")
+	assert.True(t, ok)
+	assert.Same(t, model, modelOf(reflect.TypeOf(&TestProducts{})))
+
+	assert.Equal(t, "Products", model.Name)
+	assert.Equal(t, []string{"ID"}, model.Keys)
+	names := make([]string, len(model.Properties))
+	for i, property := range model.Properties {
+		names[i] = property.Name
+	}
+	assert.Equal(t, []string{"ID", "Name", "Description", "Price", "Category_ID", "Category", "Supplier_ID", "Supplier"}, names)
+
+	price, ok := model.Property("Price")
+	assert.True(t, ok)
+	assert.Equal(t, "Decimal", price.EdmType)
+	assert.Equal(t, 9.5, price.Value(reflect.ValueOf(TestProducts{Price: 9.5})).Interface())
+
+	category, _ := model.Property("Category")
+	assert.True(t, category.Navigation)
+	assert.Empty(t, category.EdmType)
+
+	_, ok = LookupEntityModel("Unknown")
+	assert.False(t, ok)
+}
+
+func benchmarkProducts(n int) []TestProducts {
+	products := make([]TestProducts, n)
+	for i := range products {
+		products[i] = TestProducts{
+			ID:          fmt.Sprint(i),
+			Name:        fmt.Sprintf("Product %d", i),
+			Description: "Benchmark product",
+			Price:       float64(i),
+			Category_ID: "1",
+			Supplier_ID: "1",
+		}
+	}
+	return products
+}
+
+// setupBenchmark registers the test entities with logging silenced, so that
+// only the measured code shows up.
+func setupBenchmark(b *testing.B) {
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	setupTestRouter()
+	b.ReportAllocs()
+}
+
+func BenchmarkEntityToOrderedFields(b *testing.B) {
+	setupBenchmark(b)
+	products := benchmarkProducts(5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, product := range products {
+			EntityToOrderedFields(product, "")
+		}
+	}
+}
+
+func BenchmarkApplySelect(b *testing.B) {
+	setupBenchmark(b)
+	products := benchmarkProducts(5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ApplySelect(products, "$select=ID,Name")
+	}
+}
+
+func BenchmarkGenerateMetadata(b *testing.B) {
+	setupBenchmark(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GenerateMetadata()
+	}
+}
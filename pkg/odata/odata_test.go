@@ -9,8 +9,28 @@ import (
 // - setup_test.go: Contains setup and helper functions
 // - crud_test.go: Contains basic CRUD operation tests
 // - query_options_test.go: Contains tests for query options like $skip, $top, and $select
+// - ref_test.go: Contains tests for entity references ($ref)
+// - deep_insert_test.go: Contains tests for @odata.bind and deep insert
+// - deep_update_test.go: Contains tests for deep update, delta payloads and deletes
+// - etag_test.go: Contains tests for ETags and conditional requests
 // - expand_test.go: Contains tests for the $expand functionality
+// - expand_levels_test.go: Contains tests for recursive $expand with $levels
 // - field_order_test.go: Contains tests for field order
+// - filter_test.go: Contains tests for $filter, parameter aliases and $root/$it
+// - prefer_test.go: Contains tests for the Prefer header
+// - async_test.go: Contains tests for asynchronous requests and the status monitor
+// - media_test.go: Contains tests for media entities and stream properties
+// - changes_test.go: Contains tests for change tracking and delta links
+// - annotations_test.go: Contains tests for instance annotations and odata.metadata levels
+// - context_test.go: Contains tests for context URLs
+// - property_test.go: Contains tests for property names from json and odata tags
+// - tags_test.go: Contains tests for parsing and validating odata tags
+// - model_test.go: Contains tests and benchmarks for the cached entity model
+// - service_test.go: Contains tests for the service document
+// - vocabulary_test.go: Contains tests for vocabulary annotations in metadata
+// - capabilities_test.go: Contains tests for the generated Capabilities restrictions
+// - openapi_test.go: Contains tests for the OpenAPI document
+// - validate_test.go: Contains tests for validating the registry
 
 func TestPlaceholder(t *testing.T) {
 	// This is a placeholder test to ensure this file is not empty.
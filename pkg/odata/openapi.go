@@ -0,0 +1,479 @@
+package odata
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// OpenAPIVersion is the version of the API stated in the info object of the
+// OpenAPI document.
+var OpenAPIVersion = "1.0.0"
+
+// GenerateOpenAPI returns an OpenAPI 3.0 description of the registered
+// entities, following the OASIS mapping of CSDL to OpenAPI. serverURL is the
+// service root the paths are relative to, e.g. "https://example.com/odata/v4".
+func GenerateOpenAPI(serverURL string) string {
+	data, err := json.MarshalIndent(BuildMetadata().OpenAPI(serverURL), "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode OpenAPI document: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+func handleGetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc := cachedMetadata().OpenAPI(strings.TrimSuffix(serviceRoot(r), "/"))
+	w.Header().Set("Content-Type", "application/json")
+	encodeJSONPreserveOrder(w, doc)
+}
+
+// OpenAPI converts the model to an OpenAPI 3.0 document. Operations the
+// Capabilities annotations of an entity set restrict, e.g. inserts with
+// Insertable false, are left out, whether they are inline or in an
+// Annotations element targeting the entity set. So are the reads of
+// registered entity sets without a GetEntityHandler or GetEntityByIDHandler.
+func (e *Edmx) OpenAPI(serverURL string) OrderedFields {
+	paths := OrderedFields{}
+	schemas := OrderedFields{}
+	for _, schema := range e.DataServices.Schemas {
+		for _, entityType := range schema.EntityTypes {
+			schemas.add(schema.Namespace+"."+entityType.Name, entityType.openAPISchema())
+		}
+		if schema.EntityContainer == nil {
+			continue
+		}
+		for _, entitySet := range schema.EntityContainer.EntitySets {
+			entityType := e.lookupEntityType(entitySet.EntityType)
+			if entityType == nil {
+				continue
+			}
+			annotated := *entitySet
+			annotated.Annotations = append([]*EdmAnnotation(nil), entitySet.Annotations...)
+			target := schema.Namespace + "." + schema.EntityContainer.Name + "/" + entitySet.Name
+			for _, targeted := range schema.Annotations {
+				if targeted.Target == target {
+					annotated.Annotations = append(annotated.Annotations, targeted.Annotations...)
+				}
+			}
+			addEntitySetPaths(&paths, &annotated, entityType)
+		}
+		for _, functionImport := range schema.EntityContainer.FunctionImports {
+			paths.add("/"+functionImport.Name+"()", functionImport.openAPIPath(e))
+		}
+	}
+
+	doc := OrderedFields{}
+	doc.add("openapi", "3.0.0")
+	doc.add("info", OrderedFields{Fields: []struct{Key string; Value interface{}}{
+		{"title", "Service for namespace " + schemaNamespace},
+		{"version", OpenAPIVersion},
+	}})
+	doc.add("servers", []interface{}{map[string]string{"url": serverURL}})
+	doc.add("paths", paths)
+	components := OrderedFields{}
+	components.add("schemas", schemas)
+	components.add("parameters", openAPIQueryParameters())
+	// Errors are written with http.Error
+	components.add("responses", OrderedFields{Fields: []struct{Key string; Value interface{}}{
+		{"error", OrderedFields{Fields: []struct{Key string; Value interface{}}{
+			{"description", "Error"},
+			{"content", map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]string{"type": "string"}}}},
+		}}},
+	}})
+	doc.add("components", components)
+	return doc
+}
+
+// lookupEntityType returns the entity type with the qualified name.
+func (e *Edmx) lookupEntityType(qualifiedName string) *EdmEntityType {
+	dot := strings.LastIndex(qualifiedName, ".")
+	if dot < 0 {
+		return nil
+	}
+	schema := e.Schema(qualifiedName[:dot])
+	if schema == nil {
+		return nil
+	}
+	return schema.EntityType(qualifiedName[dot+1:])
+}
+
+func addEntitySetPaths(paths *OrderedFields, entitySet *EdmEntitySet, entityType *EdmEntityType) {
+	typeName := entitySet.EntityType
+	entityRef := openAPIRef("schemas", typeName)
+	// Entity sets added by metadata customizers have no handler to check
+	handler, registered := entityHandlers[entitySet.Name]
+
+	collection := OrderedFields{}
+	get := openAPIOperation(entitySet.Name, "Get entities from "+entitySet.Name)
+	parameters := []interface{}{openAPIRef("parameters", "top"), openAPIRef("parameters", "skip")}
+	if !isRestricted(entitySet, "Capabilities.CountRestrictions", "Countable") {
+		parameters = append(parameters, openAPIRef("parameters", "count"))
+	}
+	if !isRestricted(entitySet, "Capabilities.FilterRestrictions", "Filterable") {
+		parameters = append(parameters, openAPIRef("parameters", "filter"))
+	}
+	if !isRestricted(entitySet, "Capabilities.SortRestrictions", "Sortable") {
+		parameters = append(parameters, openAPIEnumParameter("$orderby", "Order items by property values", sortableProperties(entitySet, entityType)))
+	}
+	parameters = append(parameters, openAPIEnumParameter("$select", "Select properties to be returned", structuralPropertyNames(entityType)))
+	if expandable := expandableProperties(entitySet, entityType); len(expandable) > 0 {
+		parameters = append(parameters, openAPIEnumParameter("$expand", "Expand related entities", expandable))
+	}
+	get.add("parameters", parameters)
+	get.add("responses", openAPIResponses("200", "Retrieved entities", openAPICollectionSchema(typeName)))
+	if !registered || handler.GetEntityHandler != nil {
+		collection.add("get", get)
+	}
+	if !isRestricted(entitySet, "Capabilities.InsertRestrictions", "Insertable") {
+		post := openAPIOperation(entitySet.Name, "Add new entity to "+entitySet.Name)
+		post.add("requestBody", OrderedFields{Fields: []struct{Key string; Value interface{}}{
+			{"description", "New entity"},
+			{"required", true},
+			{"content", openAPIContent(entityRef)},
+		}})
+		post.add("responses", openAPIResponses("201", "Created entity", entityRef))
+		collection.add("post", post)
+	}
+	if len(collection.Fields) > 0 {
+		paths.add("/"+entitySet.Name, collection)
+	}
+
+	if entityType.Key == nil {
+		return
+	}
+	entityPath := "/" + entitySet.Name + "(" + openAPIKeyPath(entityType) + ")"
+	entity := OrderedFields{}
+	entity.add("parameters", openAPIKeyParameters(entityType))
+	get = openAPIOperation(entitySet.Name, "Get entity from "+entitySet.Name+" by key")
+	get.add("parameters", []interface{}{openAPIEnumParameter("$select", "Select properties to be returned", structuralPropertyNames(entityType))})
+	get.add("responses", openAPIResponses("200", "Retrieved entity", entityRef))
+	if !registered || handler.GetEntityByIDHandler != nil {
+		entity.add("get", get)
+	}
+	if !isRestricted(entitySet, "Capabilities.UpdateRestrictions", "Updatable") {
+		patch := openAPIOperation(entitySet.Name, "Update entity in "+entitySet.Name)
+		patch.add("requestBody", OrderedFields{Fields: []struct{Key string; Value interface{}}{
+			{"description", "Properties to update"},
+			{"required", true},
+			{"content", openAPIContent(entityRef)},
+		}})
+		patch.add("responses", openAPIResponses("200", "Updated entity", entityRef))
+		entity.add("patch", patch)
+	}
+	if !isRestricted(entitySet, "Capabilities.DeleteRestrictions", "Deletable") {
+		remove := openAPIOperation(entitySet.Name, "Delete entity from "+entitySet.Name)
+		remove.add("responses", openAPIResponses("204", "Success", nil))
+		entity.add("delete", remove)
+	}
+	// Without operations the path only holds the key parameters
+	if len(entity.Fields) > 1 {
+		paths.add(entityPath, entity)
+	}
+
+	expandable := make(map[string]bool)
+	for _, name := range expandableProperties(entitySet, entityType) {
+		expandable[name] = true
+	}
+	for _, navigationProperty := range entityType.NavigationProperties {
+		if !expandable[navigationProperty.Name] {
+			continue
+		}
+		navigation := OrderedFields{}
+		navigation.add("parameters", openAPIKeyParameters(entityType))
+		get := openAPIOperation(entitySet.Name, "Get "+navigationProperty.Name+" from "+entitySet.Name)
+		var schema interface{}
+		if elementType, ok := strings.CutPrefix(navigationProperty.Type, "Collection("); ok {
+			schema = openAPICollectionSchema(strings.TrimSuffix(elementType, ")"))
+		} else {
+			schema = openAPIRef("schemas", navigationProperty.Type)
+		}
+		get.add("responses", openAPIResponses("200", "Retrieved navigation property", schema))
+		navigation.add("get", get)
+		paths.add(entityPath+"/"+navigationProperty.Name, navigation)
+	}
+}
+
+func (f *EdmFunctionImport) openAPIPath(e *Edmx) OrderedFields {
+	var schema interface{} = map[string]interface{}{}
+	if f.EntitySet != "" {
+		for _, s := range e.DataServices.Schemas {
+			if s.EntityContainer == nil {
+				continue
+			}
+			if entitySet := s.EntityContainer.EntitySet(f.EntitySet); entitySet != nil {
+				schema = openAPICollectionSchema(entitySet.EntityType)
+			}
+		}
+	}
+	get := openAPIOperation("Service Operations", "Invoke function "+f.Name)
+	get.add("responses", openAPIResponses("200", "Success", schema))
+	path := OrderedFields{}
+	path.add("get", get)
+	return path
+}
+
+func (t *EdmEntityType) openAPISchema() OrderedFields {
+	properties := OrderedFields{}
+	for _, p := range t.Properties {
+		properties.add(p.Name, p.openAPISchema())
+	}
+	for _, p := range t.NavigationProperties {
+		if elementType, ok := strings.CutPrefix(p.Type, "Collection("); ok {
+			properties.add(p.Name, OrderedFields{Fields: []struct{Key string; Value interface{}}{
+				{"type", "array"},
+				{"items", openAPIRef("schemas", strings.TrimSuffix(elementType, ")"))},
+			}})
+			continue
+		}
+		property := OrderedFields{}
+		property.add("allOf", []interface{}{openAPIRef("schemas", p.Type)})
+		if p.Nullable != "false" {
+			property.add("nullable", true)
+		}
+		properties.add(p.Name, property)
+	}
+
+	schema := OrderedFields{}
+	schema.add("title", t.Name)
+	schema.add("type", "object")
+	schema.add("properties", properties)
+	return schema
+}
+
+// openAPISchema maps the Edm type and facets of the property to a JSON
+// schema.
+func (p *EdmProperty) openAPISchema() OrderedFields {
+	schema := OrderedFields{}
+	switch p.Type {
+	case "Edm.Int32":
+		schema.add("type", "integer")
+		schema.add("format", "int32")
+	case "Edm.Int64":
+		schema.add("type", "integer")
+		schema.add("format", "int64")
+	case "Edm.Decimal":
+		schema.add("type", "number")
+		schema.add("format", "decimal")
+	case "Edm.Boolean":
+		schema.add("type", "boolean")
+	case "Edm.DateTimeOffset":
+		schema.add("type", "string")
+		schema.add("format", "date-time")
+	case "Edm.Stream":
+		schema.add("type", "string")
+		schema.add("format", "base64url")
+	default:
+		schema.add("type", "string")
+		if maxLength, ok := csdlFacet(p.MaxLength).(int); ok {
+			schema.add("maxLength", maxLength)
+		}
+	}
+	if p.Nullable != "false" {
+		schema.add("nullable", true)
+	}
+	for _, annotation := range p.Annotations {
+		if annotation.Term == "Core.Description" {
+			schema.add("description", annotation.String)
+		}
+	}
+	return schema
+}
+
+// isRestricted reports whether the Capabilities annotation term of the
+// entity set sets the Boolean property to false.
+func isRestricted(entitySet *EdmEntitySet, term, property string) bool {
+	record := restrictionRecord(entitySet, term)
+	if record == nil {
+		return false
+	}
+	for _, value := range record.PropertyValues {
+		if value.Property == property {
+			return value.Bool == "false"
+		}
+	}
+	return false
+}
+
+func restrictionRecord(entitySet *EdmEntitySet, term string) *EdmRecord {
+	for _, annotation := range entitySet.Annotations {
+		if annotation.Term == term {
+			return annotation.Record
+		}
+	}
+	return nil
+}
+
+// restrictedPaths returns the paths listed in the collection property of the
+// Capabilities annotation term of the entity set.
+func restrictedPaths(entitySet *EdmEntitySet, term, property string) map[string]bool {
+	paths := make(map[string]bool)
+	if record := restrictionRecord(entitySet, term); record != nil {
+		for _, value := range record.PropertyValues {
+			if value.Property == property && value.Collection != nil {
+				for _, path := range value.Collection.PropertyPaths {
+					paths[path] = true
+				}
+				for _, path := range value.Collection.NavigationPropertyPaths {
+					paths[path] = true
+				}
+			}
+		}
+	}
+	return paths
+}
+
+func structuralPropertyNames(entityType *EdmEntityType) []string {
+	names := make([]string, 0, len(entityType.Properties))
+	for _, p := range entityType.Properties {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func sortableProperties(entitySet *EdmEntitySet, entityType *EdmEntityType) []string {
+	nonSortable := restrictedPaths(entitySet, "Capabilities.SortRestrictions", "NonSortableProperties")
+	var values []string
+	for _, name := range structuralPropertyNames(entityType) {
+		if !nonSortable[name] {
+			values = append(values, name, name+" desc")
+		}
+	}
+	return values
+}
+
+func expandableProperties(entitySet *EdmEntitySet, entityType *EdmEntityType) []string {
+	if isRestricted(entitySet, "Capabilities.ExpandRestrictions", "Expandable") {
+		return nil
+	}
+	nonExpandable := restrictedPaths(entitySet, "Capabilities.ExpandRestrictions", "NonExpandableProperties")
+	var names []string
+	for _, p := range entityType.NavigationProperties {
+		if !nonExpandable[p.Name] {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// openAPIKeyPath returns the key segment of entity paths, e.g. 'ID' in
+// quotes for string keys.
+func openAPIKeyPath(entityType *EdmEntityType) string {
+	segments := make([]string, 0, len(entityType.Key.PropertyRefs))
+	for _, ref := range entityType.Key.PropertyRefs {
+		segment := "{" + ref.Name + "}"
+		if p := entityType.Property(ref.Name); p == nil || p.Type == "Edm.String" {
+			segment = "'" + segment + "'"
+		}
+		if len(entityType.Key.PropertyRefs) > 1 {
+			segment = ref.Name + "=" + segment
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, ",")
+}
+
+func openAPIKeyParameters(entityType *EdmEntityType) []interface{} {
+	parameters := make([]interface{}, 0, len(entityType.Key.PropertyRefs))
+	for _, ref := range entityType.Key.PropertyRefs {
+		schema := OrderedFields{Fields: []struct{Key string; Value interface{}}{{"type", "string"}}}
+		if p := entityType.Property(ref.Name); p != nil {
+			schema = p.openAPISchema()
+			schema.Fields = removeField(schema.Fields, "nullable")
+		}
+		parameters = append(parameters, OrderedFields{Fields: []struct{Key string; Value interface{}}{
+			{"name", ref.Name},
+			{"in", "path"},
+			{"required", true},
+			{"description", "key: " + ref.Name},
+			{"schema", schema},
+		}})
+	}
+	return parameters
+}
+
+func removeField(fields []struct{Key string; Value interface{}}, key string) []struct{Key string; Value interface{}} {
+	result := fields[:0]
+	for _, field := range fields {
+		if field.Key != key {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+func openAPIOperation(tag, summary string) OrderedFields {
+	operation := OrderedFields{}
+	operation.add("summary", summary)
+	operation.add("tags", []string{tag})
+	return operation
+}
+
+// openAPIResponses returns the response for status with schema, or without
+// content if schema is nil, and the default error response.
+func openAPIResponses(status, description string, schema interface{}) OrderedFields {
+	response := OrderedFields{}
+	response.add("description", description)
+	if schema != nil {
+		response.add("content", openAPIContent(schema))
+	}
+	responses := OrderedFields{}
+	responses.add(status, response)
+	responses.add("default", openAPIRef("responses", "error"))
+	return responses
+}
+
+func openAPIContent(schema interface{}) OrderedFields {
+	return OrderedFields{Fields: []struct{Key string; Value interface{}}{
+		{"application/json", map[string]interface{}{"schema": schema}},
+	}}
+}
+
+func openAPICollectionSchema(typeName string) OrderedFields {
+	schema := OrderedFields{}
+	schema.add("title", "Collection of "+typeName[strings.LastIndex(typeName, ".")+1:])
+	schema.add("type", "object")
+	schema.add("properties", OrderedFields{Fields: []struct{Key string; Value interface{}}{
+		{"value", OrderedFields{Fields: []struct{Key string; Value interface{}}{
+			{"type", "array"},
+			{"items", openAPIRef("schemas", typeName)},
+		}}},
+	}})
+	return schema
+}
+
+func openAPIRef(component, name string) map[string]string {
+	return map[string]string{"$ref": "#/components/" + component + "/" + name}
+}
+
+func openAPIEnumParameter(name, description string, values []string) OrderedFields {
+	parameter := OrderedFields{}
+	parameter.add("name", name)
+	parameter.add("in", "query")
+	parameter.add("description", description)
+	parameter.add("explode", false)
+	parameter.add("schema", OrderedFields{Fields: []struct{Key string; Value interface{}}{
+		{"type", "array"},
+		{"uniqueItems", true},
+		{"items", map[string]interface{}{"type": "string", "enum": values}},
+	}})
+	return parameter
+}
+
+func openAPIQueryParameters() OrderedFields {
+	parameter := func(name, description string, schema map[string]interface{}) OrderedFields {
+		return OrderedFields{Fields: []struct{Key string; Value interface{}}{
+			{"name", name},
+			{"in", "query"},
+			{"description", description},
+			{"schema", schema},
+		}}
+	}
+	parameters := OrderedFields{}
+	parameters.add("top", parameter("$top", "Show only the first n items", map[string]interface{}{"type": "integer", "minimum": 0}))
+	parameters.add("skip", parameter("$skip", "Skip the first n items", map[string]interface{}{"type": "integer", "minimum": 0}))
+	parameters.add("count", parameter("$count", "Include count of items", map[string]interface{}{"type": "boolean"}))
+	parameters.add("filter", parameter("$filter", "Filter items by property values", map[string]interface{}{"type": "string"}))
+	return parameters
+}
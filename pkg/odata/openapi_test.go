@@ -0,0 +1,113 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPI(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## openapi_test - TestOpenAPI")
+	fmt.Println("")
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	metadataCustomizers = nil
+	defer func() { metadataCustomizers = nil }()
+	r := setupTestRouter()
+	RegisterMetadataCustomizer(func(edmx *Edmx) {
+		container := edmx.Schema("CatalogService").EntityContainer
+		container.FunctionImports = append(container.FunctionImports, &EdmFunctionImport{Name: "TopProducts", Function: "CatalogService.TopProducts", EntitySet: "Products"})
+	})
+
+	req, _ := http.NewRequest("GET", "/odata/v4/openapi.json", nil)
+	req.Host = "example.com"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &doc)
+	assert.NoError(t, err)
+	assert.Equal(t, "3.0.0", doc.OpenAPI)
+	assert.Equal(t, "http://example.com/odata/v4", doc.Servers[0].URL)
+
+	methods := func(path string) []string {
+		var result []string
+		for _, method := range []string{"get", "post", "patch", "delete"} {
+			if _, ok := doc.Paths[path][method]; ok {
+				result = append(result, method)
+			}
+		}
+		return result
+	}
+	// Products has no updater or deleter; Suppliers only reads
+	assert.Equal(t, []string{"get", "post"}, methods("/Products"))
+	assert.Equal(t, []string{"get"}, methods("/Products('{ID}')"))
+	assert.Equal(t, []string{"get"}, methods("/Products('{ID}')/Category"))
+	assert.Equal(t, []string{"get"}, methods("/Suppliers"))
+	assert.Equal(t, []string{"get"}, methods("/TopProducts()"))
+
+	var get struct {
+		Parameters []struct {
+			Ref  string `json:"$ref"`
+			Name string `json:"name"`
+		} `json:"parameters"`
+	}
+	err = json.Unmarshal(doc.Paths["/Products"]["get"], &get)
+	assert.NoError(t, err)
+	var parameters []string
+	for _, parameter := range get.Parameters {
+		parameters = append(parameters, parameter.Ref+parameter.Name)
+	}
+	assert.Equal(t, []string{
+		"#/components/parameters/top",
+		"#/components/parameters/skip",
+		"#/components/parameters/count",
+		"#/components/parameters/filter",
+		"$orderby",
+		"$select",
+		"$expand",
+	}, parameters)
+
+	products := doc.Components.Schemas["CatalogService.Products"].Properties
+	assert.Equal(t, map[string]interface{}{"type": "string"}, products["ID"])
+	assert.Equal(t, map[string]interface{}{"type": "number", "format": "decimal", "nullable": true}, products["Price"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"$ref": "#/components/schemas/CatalogService.Categories"}}, products["Category"]["allOf"])
+	assert.Equal(t, "array", doc.Components.Schemas["CatalogService.Categories"].Properties["Products"]["type"])
+
+	// The library function describes the same model
+	var generated map[string]interface{}
+	err = json.Unmarshal([]byte(GenerateOpenAPI("http://example.com/odata/v4")), &generated)
+	assert.NoError(t, err)
+	var served map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &served)
+	assert.Equal(t, served, generated)
+
+	// Registered restrictions apply, and reads without a handler are left out
+	RegisterAnnotations("EntityContainer/Products", capabilityRestrictions("Capabilities.InsertRestrictions", "Insertable", false, "", nil))
+	defer func() { vocabularyAnnotations = nil }()
+	RegisterEntity(TestLedgerLines{}, EntityHandler{GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {}})
+	doc.Paths = nil
+	err = json.Unmarshal([]byte(GenerateOpenAPI("http://example.com/odata/v4")), &doc)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"get"}, methods("/Products"))
+	assert.Equal(t, []string{"get"}, methods("/LedgerLines"))
+	assert.NotContains(t, doc.Paths, "/LedgerLines('{ID}')")
+}
@@ -0,0 +1,796 @@
+package odata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EntityPayload is the decoded body of a create or update request. Properties
+// are decoded into Entity, a value of the registered entity type,
+// single-valued @odata.bind annotations are applied to the foreign key
+// property, and nested entities are kept for deep insert and deep update.
+type EntityPayload struct {
+	EntitySet string
+	Entity    interface{}
+	// ID is the key of the existing entity the payload updates, taken from
+	// the request URL or an @id annotation. It is empty for new entities.
+	ID string
+	// Removed marks a delta entry annotated with @removed. RemovedReason is
+	// "deleted" when the entity itself is to be deleted rather than unlinked.
+	Removed       bool
+	RemovedReason string
+	// Bindings holds the keys bound through collection-valued @odata.bind
+	// annotations, by relationship name.
+	Bindings map[string][]string
+	// Nested holds the related entities to create, update or remove along
+	// with this one, by relationship name.
+	Nested map[string][]*EntityPayload
+	// IfMatch is the ETag the existing entity had when the If-Match header
+	// of the request was checked. It is passed to a ConditionalUpdater.
+	IfMatch string
+	// Delta marks nested collections sent as <Name>@delta. Their entries are
+	// applied as changes instead of replacing the related collection.
+	Delta map[string]bool
+}
+
+// ParseEntityPayload decodes the JSON body of r as a new entity of entitySet,
+// resolving @odata.bind annotations and nested entities through the
+// relationships registered with RegisterEntityRelationship.
+func ParseEntityPayload(r *http.Request, entitySet string) (*EntityPayload, error) {
+	body, err := decodeRequestBody(r)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	payload, err := decodeEntityPayload(entitySet, body, "")
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	return payload, nil
+}
+
+// ParseEntityUpdate decodes the JSON body of r as changes to the entity of
+// entitySet identified by id. The properties are merged onto the current
+// entity, read through the EntityReader of the entity set.
+func ParseEntityUpdate(r *http.Request, entitySet, id string) (*EntityPayload, error) {
+	body, err := decodeRequestBody(r)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	payload, err := decodeEntityPayload(entitySet, body, id)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	if payload.Removed {
+		return nil, badRequest(fmt.Errorf("@removed is only allowed in collections"))
+	}
+	return payload, nil
+}
+
+// ParseDeltaPayload decodes a delta payload sent to an entity set, where
+// "value" lists the entities to create, update (@id) or remove (@removed).
+func ParseDeltaPayload(r *http.Request, entitySet string) ([]*EntityPayload, error) {
+	body, err := decodeRequestBody(r)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	entries, ok := body["value"].([]interface{})
+	if !ok {
+		return nil, badRequest(fmt.Errorf("delta payload must contain a value array"))
+	}
+
+	payloads := make([]*EntityPayload, 0, len(entries))
+	for _, entry := range entries {
+		object, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, badRequest(fmt.Errorf("delta payload entries must be entities"))
+		}
+		payload, err := decodeEntityPayload(entitySet, object, "")
+		if err != nil {
+			return nil, badRequest(err)
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
+
+func decodeRequestBody(r *http.Request) (map[string]interface{}, error) {
+	var body map[string]interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+	return body, nil
+}
+
+func decodeEntityPayload(entitySet string, body map[string]interface{}, id string) (*EntityPayload, error) {
+	entityType, ok := lookupEntityType(entitySet)
+	if !ok {
+		return nil, fmt.Errorf("entity set not found: %s", entitySet)
+	}
+	typ := reflect.TypeOf(entityType)
+	relationships := entityRelationships[entitySet]
+	handler, _ := GetEntityHandler(entitySet)
+
+	payload := &EntityPayload{
+		EntitySet: entitySet,
+		ID:        id,
+		Bindings:  make(map[string][]string),
+		Nested:    make(map[string][]*EntityPayload),
+		Delta:     make(map[string]bool),
+	}
+
+	// Entries of nested collections and delta payloads address existing
+	// entities with @id (4.01) or @odata.id (4.0)
+	for _, annotation := range []string{"@id", "@odata.id"} {
+		if odataID, ok := body[annotation].(string); ok && payload.ID == "" {
+			key, err := parseEntityID(odataID, entitySet)
+			if err != nil {
+				return nil, err
+			}
+			payload.ID = key
+		}
+	}
+
+	if removed, ok := body["@removed"]; ok {
+		if payload.ID == "" {
+			return nil, fmt.Errorf("removed entities must be identified with @id")
+		}
+		payload.Removed = true
+		if info, ok := removed.(map[string]interface{}); ok {
+			payload.RemovedReason, _ = info["reason"].(string)
+		}
+		return payload, nil
+	}
+
+	var base interface{}
+	if payload.ID != "" {
+		if handler.EntityReader == nil {
+			return nil, fmt.Errorf("%w: %s does not support updates", ErrNotImplemented, entitySet)
+		}
+		current, found := handler.ReadEntity(payload.ID)
+		if !found {
+			return nil, fmt.Errorf("%w: %s(%s)", ErrEntityNotFound, entitySet, payload.ID)
+		}
+		base = current
+	}
+
+	properties := make(map[string]interface{})
+	foreignKeys := make(map[string]string)
+
+	for key, value := range body {
+		if strings.HasSuffix(key, "@odata.bind") {
+			relationshipName := strings.TrimSuffix(key, "@odata.bind")
+			relInfo, ok := relationships[relationshipName]
+			if !ok {
+				return nil, fmt.Errorf("unknown navigation property %s on %s", relationshipName, entitySet)
+			}
+
+			if relInfo.isCollection() {
+				ids, ok := value.([]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s must be an array of entity ids", key)
+				}
+				for _, id := range ids {
+					idString, _ := id.(string)
+					targetID, err := parseEntityID(idString, relInfo.TargetEntity)
+					if err != nil {
+						return nil, err
+					}
+					payload.Bindings[relationshipName] = append(payload.Bindings[relationshipName], targetID)
+				}
+				continue
+			}
+
+			idString, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be an entity id", key)
+			}
+			targetID, err := parseEntityID(idString, relInfo.TargetEntity)
+			if err != nil {
+				return nil, err
+			}
+			foreignKey, ok := relationshipForeignKey(entitySet, relationshipName)
+			if !ok {
+				return nil, fmt.Errorf("cannot bind %s: %s has no foreign key for it", relationshipName, entitySet)
+			}
+			foreignKeys[foreignKey] = targetID
+			continue
+		}
+
+		if strings.HasSuffix(key, "@delta") {
+			relationshipName := strings.TrimSuffix(key, "@delta")
+			relInfo, ok := relationships[relationshipName]
+			if !ok || !relInfo.isCollection() {
+				return nil, fmt.Errorf("%s must be a collection-valued navigation property", relationshipName)
+			}
+			nested, err := decodeNestedPayloads(entitySet, typ, relationshipName, relInfo, value)
+			if err != nil {
+				return nil, err
+			}
+			payload.Nested[relationshipName] = nested
+			payload.Delta[relationshipName] = true
+			continue
+		}
+
+		// Skip control information and instance annotations
+		if strings.Contains(key, "@") {
+			continue
+		}
+
+		if relInfo, ok := relationships[key]; ok {
+			nested, err := decodeNestedPayloads(entitySet, typ, key, relInfo, value)
+			if err != nil {
+				return nil, err
+			}
+			payload.Nested[key] = nested
+			continue
+		}
+
+		properties[key] = value
+	}
+
+	entity, err := decodeEntityProperties(typ, base, properties)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %v", entitySet, err)
+	}
+	for foreignKey, targetID := range foreignKeys {
+		if entity, err = setEntityField(entity, foreignKey, targetID); err != nil {
+			return nil, err
+		}
+	}
+	payload.Entity = entity
+	return payload, nil
+}
+
+func decodeNestedPayloads(entitySet string, typ reflect.Type, relationshipName string, relInfo RelationshipInfo, value interface{}) ([]*EntityPayload, error) {
+	var bodies []interface{}
+	if relInfo.isCollection() {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must be an array of entities", relationshipName)
+		}
+		bodies = items
+	} else {
+		if _, ok := relationshipForeignKey(entitySet, relationshipName); !ok {
+			return nil, fmt.Errorf("cannot deep insert %s: %s has no foreign key for it", relationshipName, entitySet)
+		}
+		bodies = []interface{}{value}
+	}
+
+	nested := make([]*EntityPayload, 0, len(bodies))
+	for _, body := range bodies {
+		object, ok := body.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must contain entities", relationshipName)
+		}
+		payload, err := decodeEntityPayload(relInfo.TargetEntity, object, "")
+		if err != nil {
+			return nil, err
+		}
+		nested = append(nested, payload)
+	}
+	return nested, nil
+}
+
+// ApplyDeepInsert creates the entity in payload and all nested entities
+// through the EntityCreator registered for each entity set. Related entities
+// referenced by a foreign key are created first, collection members after
+// their parent with the partner foreign key set. The created entity is
+// returned with the nested entities appended under their relationship name.
+//
+// The whole payload is checked against the registered handlers before the
+// first write, so a missing handler writes nothing. A handler error after
+// that stops the insert: if the entity set has a Transactioner the writes are
+// rolled back, otherwise the entities written so far are kept and the error
+// is returned.
+func ApplyDeepInsert(payload *EntityPayload) (OrderedFields, error) {
+	var result OrderedFields
+	err := applyInTransaction(payload.EntitySet, []*EntityPayload{payload}, func(changes *changeBuffer) (err error) {
+		result, err = applyEntityPayload(payload, changes)
+		return err
+	})
+	return result, err
+}
+
+// ApplyDeepUpdate updates the entity in payload through the EntityUpdater of
+// its entity set and applies the nested entities: entries with @id are
+// updated, entries without are created and @removed entries are deleted when
+// the reason is "deleted" and unlinked otherwise. A nested collection sent
+// without @delta replaces the related collection, so existing members missing
+// from it are unlinked. Unlinking uses the LinkHandler of the entity set or
+// clears the foreign key of the member, and fails with ErrNotImplemented when
+// neither is possible. Failures are handled as in ApplyDeepInsert.
+func ApplyDeepUpdate(payload *EntityPayload) (OrderedFields, error) {
+	return ApplyDeepInsert(payload)
+}
+
+// ApplyDelta applies the entries of a delta payload to their entity set and
+// returns the created and updated entities. Removed entries are deleted.
+// Failures are handled as in ApplyDeepInsert, with one transaction covering
+// all entries.
+func ApplyDelta(payloads []*EntityPayload) ([]OrderedFields, error) {
+	result := make([]OrderedFields, 0, len(payloads))
+	if len(payloads) == 0 {
+		return result, nil
+	}
+	err := applyInTransaction(payloads[0].EntitySet, payloads, func(changes *changeBuffer) error {
+		for _, payload := range payloads {
+			if payload.Removed {
+				if err := deleteEntity(payload.EntitySet, payload.ID, changes); err != nil {
+					return err
+				}
+				continue
+			}
+			applied, err := applyEntityPayload(payload, changes)
+			if err != nil {
+				return err
+			}
+			result = append(result, applied)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// applyInTransaction checks payloads and runs apply in a transaction of the
+// Transactioner of entitySet, if it has one. The changes apply records are
+// passed to ChangeTracking once the transaction is committed, so rolled back
+// writes never show up in a delta. Without a Transactioner the writes made
+// before a failure are kept, so their changes are recorded regardless.
+func applyInTransaction(entitySet string, payloads []*EntityPayload, apply func(changes *changeBuffer) error) error {
+	for _, payload := range payloads {
+		if err := checkEntityPayload(payload, true); err != nil {
+			return err
+		}
+	}
+	changes := &changeBuffer{}
+	handler, _ := GetEntityHandler(entitySet)
+	if handler.Transactioner == nil {
+		defer changes.flush()
+		return apply(changes)
+	}
+	if err := handler.BeginTransaction(); err != nil {
+		return err
+	}
+	if err := apply(changes); err != nil {
+		if rollbackErr := handler.RollbackTransaction(); rollbackErr != nil {
+			log.Printf("applyInTransaction: Rolling back %s failed: %v", entitySet, rollbackErr)
+		}
+		return err
+	}
+	if err := handler.CommitTransaction(); err != nil {
+		return err
+	}
+	changes.flush()
+	return nil
+}
+
+// checkEntityPayload reports the first handler missing to apply payload and
+// its nested entities. topLevel allows @removed entries, as in a delta
+// payload.
+func checkEntityPayload(payload *EntityPayload, topLevel bool) error {
+	handler, ok := GetEntityHandler(payload.EntitySet)
+	if !ok {
+		return fmt.Errorf("entity set not found: %s", payload.EntitySet)
+	}
+	if payload.Removed {
+		if !topLevel {
+			return badRequest(fmt.Errorf("@removed is only allowed in collections"))
+		}
+		if handler.EntityDeleter == nil {
+			return fmt.Errorf("%w: %s does not support deletes", ErrNotImplemented, payload.EntitySet)
+		}
+		return nil
+	}
+	if payload.ID == "" && handler.EntityCreator == nil {
+		return fmt.Errorf("%w: %s does not support inserts", ErrNotImplemented, payload.EntitySet)
+	}
+	if payload.ID != "" && handler.EntityUpdater == nil {
+		return fmt.Errorf("%w: %s does not support updates", ErrNotImplemented, payload.EntitySet)
+	}
+
+	for relationshipName, items := range payload.Nested {
+		relInfo := entityRelationships[payload.EntitySet][relationshipName]
+		if !relInfo.isCollection() {
+			if err := checkEntityPayload(items[0], false); err != nil {
+				return err
+			}
+			continue
+		}
+		_, hasPartnerKey := partnerForeignKey(payload.EntitySet, relationshipName)
+		unlinks := payload.ID != "" && !payload.Delta[relationshipName]
+		if unlinks && (handler.EntityReader == nil || handler.ExpandHandler == nil) {
+			return fmt.Errorf("%w: %s cannot replace %s", ErrNotImplemented, payload.EntitySet, relationshipName)
+		}
+		for _, item := range items {
+			if !item.Removed {
+				if !hasPartnerKey && handler.LinkHandler == nil {
+					return fmt.Errorf("%w: %s does not support linking %s", ErrNotImplemented, payload.EntitySet, relationshipName)
+				}
+				if err := checkEntityPayload(item, false); err != nil {
+					return err
+				}
+				continue
+			}
+			if item.RemovedReason == "deleted" {
+				if err := checkEntityPayload(item, true); err != nil {
+					return err
+				}
+				continue
+			}
+			unlinks = true
+		}
+		if unlinks && handler.LinkHandler == nil {
+			targetHandler, _ := GetEntityHandler(relInfo.TargetEntity)
+			if !hasPartnerKey || targetHandler.EntityReader == nil || targetHandler.EntityUpdater == nil {
+				return fmt.Errorf("%w: %s does not support unlinking %s", ErrNotImplemented, payload.EntitySet, relationshipName)
+			}
+		}
+	}
+
+	if len(payload.Bindings) > 0 && handler.LinkHandler == nil {
+		return fmt.Errorf("%w: %s does not support binding", ErrNotImplemented, payload.EntitySet)
+	}
+	return nil
+}
+
+func applyEntityPayload(payload *EntityPayload, changes *changeBuffer) (OrderedFields, error) {
+	handler, ok := GetEntityHandler(payload.EntitySet)
+	if !ok {
+		return OrderedFields{}, fmt.Errorf("entity set not found: %s", payload.EntitySet)
+	}
+	if payload.Removed {
+		return OrderedFields{}, badRequest(fmt.Errorf("@removed is only allowed in collections"))
+	}
+	if payload.ID == "" && handler.EntityCreator == nil {
+		return OrderedFields{}, fmt.Errorf("%w: %s does not support inserts", ErrNotImplemented, payload.EntitySet)
+	}
+	if payload.ID != "" && handler.EntityUpdater == nil {
+		return OrderedFields{}, fmt.Errorf("%w: %s does not support updates", ErrNotImplemented, payload.EntitySet)
+	}
+	relationships := entityRelationships[payload.EntitySet]
+
+	relationshipNames := make([]string, 0, len(payload.Nested))
+	for relationshipName := range payload.Nested {
+		relationshipNames = append(relationshipNames, relationshipName)
+	}
+	sort.Strings(relationshipNames)
+
+	entity := payload.Entity
+	nestedResults := make(map[string]interface{})
+
+	// Related entities referenced by a foreign key must exist before this one
+	for _, relationshipName := range relationshipNames {
+		if relationships[relationshipName].isCollection() {
+			continue
+		}
+		related, err := applyEntityPayload(payload.Nested[relationshipName][0], changes)
+		if err != nil {
+			return OrderedFields{}, err
+		}
+		foreignKey, _ := relationshipForeignKey(payload.EntitySet, relationshipName)
+		if entity, err = setEntityField(entity, foreignKey, entityKeyValue(related)); err != nil {
+			return OrderedFields{}, badRequest(err)
+		}
+		nestedResults[relationshipName] = related
+	}
+
+	var written interface{}
+	var err error
+	if payload.ID == "" {
+		log.Printf("applyEntityPayload: Creating %s", payload.EntitySet)
+		written, err = handler.CreateEntity(entity)
+	} else {
+		log.Printf("applyEntityPayload: Updating %s(%s)", payload.EntitySet, payload.ID)
+		if updater, ok := handler.EntityUpdater.(ConditionalUpdater); ok && payload.IfMatch != "" {
+			written, err = updater.UpdateEntityIfMatch(payload.ID, payload.IfMatch, entity)
+		} else {
+			written, err = handler.UpdateEntity(payload.ID, entity)
+		}
+	}
+	if err != nil {
+		return OrderedFields{}, err
+	}
+	result := toOrderedFields(written, "")
+	if result.EntityName == "" {
+		result.EntityName = payload.EntitySet
+	}
+	id, err := writtenEntityID(result)
+	if err != nil {
+		return OrderedFields{}, err
+	}
+	changes.record(payload.EntitySet, id, false)
+
+	// Collection members reference this entity, so they are written after it
+	for _, relationshipName := range relationshipNames {
+		relInfo := relationships[relationshipName]
+		if !relInfo.isCollection() {
+			continue
+		}
+		items, err := applyNestedCollection(handler, payload, id, relationshipName, relInfo, changes)
+		if err != nil {
+			return OrderedFields{}, err
+		}
+		nestedResults[relationshipName] = items
+	}
+
+	for relationshipName, targetIDs := range payload.Bindings {
+		if handler.LinkHandler == nil {
+			return OrderedFields{}, fmt.Errorf("%w: %s does not support binding %s", ErrNotImplemented, payload.EntitySet, relationshipName)
+		}
+		for _, targetID := range targetIDs {
+			if err := handler.CreateLink(id, relationshipName, targetID); err != nil {
+				return OrderedFields{}, err
+			}
+			changes.recordLink(payload.EntitySet, id, entityRelationships[payload.EntitySet][relationshipName], targetID)
+		}
+	}
+
+	for _, relationshipName := range relationshipNames {
+		result.Fields = append(result.Fields, struct{Key string; Value interface{}}{Key: relationshipName, Value: nestedResults[relationshipName]})
+	}
+	return result, nil
+}
+
+func applyNestedCollection(handler EntityHandler, payload *EntityPayload, id, relationshipName string, relInfo RelationshipInfo, changes *changeBuffer) ([]OrderedFields, error) {
+	partnerKey, hasPartnerKey := partnerForeignKey(payload.EntitySet, relationshipName)
+	items := make([]OrderedFields, 0, len(payload.Nested[relationshipName]))
+	kept := make(map[string]bool)
+
+	for _, item := range payload.Nested[relationshipName] {
+		if item.Removed {
+			if err := removeRelatedEntity(handler, payload.EntitySet, id, relationshipName, item, changes); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var err error
+		if hasPartnerKey {
+			if item.Entity, err = setEntityField(item.Entity, partnerKey, id); err != nil {
+				return nil, badRequest(err)
+			}
+		}
+		written, err := applyEntityPayload(item, changes)
+		if err != nil {
+			return nil, err
+		}
+		itemID, err := writtenEntityID(written)
+		if err != nil {
+			return nil, err
+		}
+		if !hasPartnerKey {
+			if handler.LinkHandler == nil {
+				return nil, fmt.Errorf("%w: %s does not support linking %s", ErrNotImplemented, payload.EntitySet, relationshipName)
+			}
+			if err := handler.CreateLink(id, relationshipName, itemID); err != nil {
+				return nil, err
+			}
+			changes.recordLink(payload.EntitySet, id, relInfo, itemID)
+		}
+		kept[itemID] = true
+		items = append(items, written)
+	}
+
+	// A nested collection without @delta in an update replaces the related
+	// collection, so members that were not sent are removed
+	if payload.ID == "" || payload.Delta[relationshipName] {
+		return items, nil
+	}
+	if handler.EntityReader == nil || handler.ExpandHandler == nil {
+		return nil, fmt.Errorf("%w: %s cannot replace %s", ErrNotImplemented, payload.EntitySet, relationshipName)
+	}
+	current, found := handler.ReadEntity(payload.ID)
+	if !found {
+		return items, nil
+	}
+	related := handler.ExpandEntity(toOrderedFields(current, ""), relationshipName, "")
+	relatedValue := reflect.ValueOf(related)
+	if relatedValue.Kind() != reflect.Slice {
+		return items, nil
+	}
+	for i := 0; i < relatedValue.Len(); i++ {
+		member := toOrderedFields(relatedValue.Index(i).Interface(), "")
+		if member.EntityName == "" {
+			member.EntityName = relInfo.TargetEntity
+		}
+		memberID := fmt.Sprint(entityKeyValue(member))
+		if kept[memberID] {
+			continue
+		}
+		removed := &EntityPayload{EntitySet: relInfo.TargetEntity, ID: memberID, Removed: true}
+		if err := removeRelatedEntity(handler, payload.EntitySet, id, relationshipName, removed, changes); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// removeRelatedEntity removes item from relationshipName of the entity id of
+// entitySet.
+// Entities removed with reason "deleted" are deleted. Others are only
+// unlinked: through the LinkHandler of the entity set, or by clearing the
+// partner foreign key of the related entity through its EntityUpdater.
+func removeRelatedEntity(handler EntityHandler, entitySet, id, relationshipName string, item *EntityPayload, changes *changeBuffer) error {
+	if item.RemovedReason == "deleted" {
+		return deleteEntity(item.EntitySet, item.ID, changes)
+	}
+	log.Printf("removeRelatedEntity: Unlinking %s(%s) from %s", item.EntitySet, item.ID, relationshipName)
+	if handler.LinkHandler != nil {
+		if err := handler.DeleteLink(id, relationshipName, item.ID); err != nil {
+			return err
+		}
+		changes.record(item.EntitySet, item.ID, false)
+		return nil
+	}
+	return clearPartnerForeignKey(entitySet, relationshipName, item, changes)
+}
+
+// clearPartnerForeignKey unlinks item from relationshipName of entitySet by
+// resetting the foreign key that points back at entitySet to its zero value.
+func clearPartnerForeignKey(entitySet, relationshipName string, item *EntityPayload, changes *changeBuffer) error {
+	partnerKey, ok := partnerForeignKey(entitySet, relationshipName)
+	targetHandler, found := GetEntityHandler(item.EntitySet)
+	if !ok || !found || targetHandler.EntityReader == nil || targetHandler.EntityUpdater == nil {
+		return fmt.Errorf("%w: %s does not support unlinking %s", ErrNotImplemented, entitySet, relationshipName)
+	}
+	target, found := targetHandler.ReadEntity(item.ID)
+	if !found {
+		return fmt.Errorf("%w: %s(%s)", ErrEntityNotFound, item.EntitySet, item.ID)
+	}
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() == reflect.Ptr {
+		targetValue = targetValue.Elem()
+	}
+	property, ok := modelOf(targetValue.Type()).Property(partnerKey)
+	if !ok {
+		return fmt.Errorf("field %s not found", partnerKey)
+	}
+	unlinked, err := setEntityField(targetValue.Interface(), partnerKey, reflect.Zero(property.Field.Type).Interface())
+	if err != nil {
+		return err
+	}
+	if _, err := targetHandler.UpdateEntity(item.ID, unlinked); err != nil {
+		return err
+	}
+	changes.record(item.EntitySet, item.ID, false)
+	return nil
+}
+
+func deleteEntity(entitySet, id string, changes *changeBuffer) error {
+	handler, ok := GetEntityHandler(entitySet)
+	if !ok || handler.EntityDeleter == nil {
+		return fmt.Errorf("%w: %s does not support deletes", ErrNotImplemented, entitySet)
+	}
+	log.Printf("deleteEntity: Deleting %s(%s)", entitySet, id)
+	if err := handler.DeleteEntity(id); err != nil {
+		return err
+	}
+	changes.record(entitySet, id, true)
+	return nil
+}
+
+// partnerForeignKey returns the foreign key on the target of a collection
+// relationship that points back at entitySet, e.g. OrderItems.Order_ID for
+// Orders.Items.
+func partnerForeignKey(entitySet, relationshipName string) (string, bool) {
+	partner, ok := relationshipPartner(entitySet, relationshipName)
+	if !ok {
+		return "", false
+	}
+	return relationshipForeignKey(entityRelationships[entitySet][relationshipName].TargetEntity, partner)
+}
+
+// writtenEntityID returns the key of an entity returned by a handler, which
+// nested entities are linked to. An entity sent without a key that the
+// handler did not generate one for is a bad request.
+func writtenEntityID(entity OrderedFields) (string, error) {
+	key := entityKeyValue(entity)
+	if key == nil || key == "" {
+		return "", badRequest(fmt.Errorf("%s entity has no key value", entity.EntityName))
+	}
+	return fmt.Sprint(key), nil
+}
+
+// entityKeyValue returns the value of the first key field of entity.
+func entityKeyValue(entity OrderedFields) interface{} {
+	keyFields := entityKeyFields(entity.EntityName)
+	if len(keyFields) == 0 {
+		return nil
+	}
+	for _, field := range entity.Fields {
+		if field.Key == keyFields[0] {
+			return field.Value
+		}
+	}
+	return nil
+}
+
+// decodeEntityProperties decodes properties onto a copy of base, or onto a
+// new value of typ when base is nil, rejecting properties the type does not
+// declare.
+func decodeEntityProperties(typ reflect.Type, base interface{}, properties map[string]interface{}) (interface{}, error) {
+	// Properties named with odata:"name:..." are known to encoding/json by
+	// their field name
+	for _, property := range modelOf(typ).Properties {
+		if value, ok := properties[property.Name]; ok && property.Name != property.JSONName {
+			delete(properties, property.Name)
+			properties[property.JSONName] = value
+		}
+	}
+	data, err := json.Marshal(properties)
+	if err != nil {
+		return nil, err
+	}
+	entity := reflect.New(typ)
+	if base != nil {
+		baseValue := reflect.ValueOf(base)
+		if baseValue.Kind() == reflect.Ptr {
+			baseValue = baseValue.Elem()
+		}
+		if baseValue.Type() != typ {
+			return nil, fmt.Errorf("EntityReader returned %s, expected %s", baseValue.Type(), typ)
+		}
+		entity.Elem().Set(baseValue)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(entity.Interface()); err != nil {
+		return nil, err
+	}
+	return entity.Elem().Interface(), nil
+}
+
+// setEntityField returns a copy of entity with the property fieldName set to
+// value, converting between strings and numbers where needed.
+func setEntityField(entity interface{}, fieldName string, value interface{}) (interface{}, error) {
+	copyValue := reflect.New(reflect.TypeOf(entity)).Elem()
+	copyValue.Set(reflect.ValueOf(entity))
+
+	property, ok := modelOf(copyValue.Type()).Property(fieldName)
+	if !ok {
+		return nil, fmt.Errorf("field %s not found", fieldName)
+	}
+	field := property.Value(copyValue)
+	if !field.CanSet() {
+		return nil, fmt.Errorf("field %s not found", fieldName)
+	}
+
+	v := reflect.ValueOf(value)
+	if v.IsValid() && v.Type().AssignableTo(field.Type()) {
+		field.Set(v)
+		return copyValue.Interface(), nil
+	}
+
+	s := fmt.Sprint(value)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for %s", s, fieldName)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for %s", s, fieldName)
+		}
+		field.SetUint(n)
+	default:
+		return nil, fmt.Errorf("unsupported type %s for %s", field.Type(), fieldName)
+	}
+	return copyValue.Interface(), nil
+}
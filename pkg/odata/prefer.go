@@ -0,0 +1,268 @@
+package odata
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Preferences holds the preferences a client sent in the Prefer header.
+type Preferences struct {
+	// Return is "minimal" or "representation" when the client asked for a
+	// specific response to a data modification request.
+	Return string
+	// IncludeAnnotations is the odata.include-annotations pattern list, e.g.
+	// "display.*,-display.secret".
+	IncludeAnnotations string
+	// RespondAsync is set when the client prefers asynchronous processing.
+	RespondAsync bool
+
+	values map[string]string
+}
+
+// Get returns the value of an arbitrary preference and whether it was sent.
+func (p Preferences) Get(name string) (string, bool) {
+	value, ok := p.values[strings.ToLower(name)]
+	return value, ok
+}
+
+// ParsePreferences parses the values of one or more Prefer headers.
+func ParsePreferences(headers []string) Preferences {
+	prefs := Preferences{values: make(map[string]string)}
+	for _, header := range headers {
+		for _, preference := range splitQuoted(header, ',') {
+			// Preference parameters after ';' are not used by any preference
+			// we support.
+			preference = splitQuoted(preference, ';')[0]
+			name, value, _ := strings.Cut(preference, "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			if name == "" {
+				continue
+			}
+			if _, seen := prefs.values[name]; seen {
+				// The first occurrence of a preference wins
+				continue
+			}
+			prefs.values[name] = value
+
+			switch name {
+			case "return":
+				prefs.Return = strings.ToLower(value)
+			case "odata.include-annotations":
+				prefs.IncludeAnnotations = value
+			case "respond-async":
+				prefs.RespondAsync = true
+			}
+		}
+	}
+	return prefs
+}
+
+// splitQuoted splits s on sep outside of double-quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	inString := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			inString = !inString
+		case sep:
+			if !inString {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+type preferencesKey struct{}
+
+// RequestPreferences returns the preferences of r. Requests routed through
+// RegisterRoutes have them parsed once; other requests are parsed on demand.
+func RequestPreferences(r *http.Request) Preferences {
+	if prefs, ok := r.Context().Value(preferencesKey{}).(Preferences); ok {
+		return prefs
+	}
+	return ParsePreferences(r.Header.Values("Prefer"))
+}
+
+// withPreferences parses the Prefer header into the request context and wraps
+// the response writer so the response helpers can honor the preferences.
+func withPreferences(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefs := ParsePreferences(r.Header.Values("Prefer"))
+		r = r.WithContext(context.WithValue(r.Context(), preferencesKey{}, prefs))
+		next.ServeHTTP(newPreferenceResponseWriter(w, r, prefs), r)
+	})
+}
+
+func newPreferenceResponseWriter(w http.ResponseWriter, r *http.Request, prefs Preferences) *preferenceResponseWriter {
+	return &preferenceResponseWriter{
+		ResponseWriter: w,
+		prefs:          prefs,
+		method:         r.Method,
+		metadata:       metadataLevel(r),
+		serviceRoot:    serviceRoot(r),
+		query:          r.URL.RawQuery,
+	}
+}
+
+// preferenceResponseWriter carries the request preferences, the requested
+// odata.metadata level and what the context URL is derived from to the
+// response helpers, and emits Preference-Applied for the preferences they
+// honored.
+type preferenceResponseWriter struct {
+	http.ResponseWriter
+	prefs       Preferences
+	method      string
+	metadata    string
+	serviceRoot string
+	query       string
+	applied     []string
+	wroteHeader bool
+	// deltaLink is added to collection responses when change tracking was
+	// requested
+	deltaLink string
+}
+
+func (w *preferenceResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.prefs.IncludeAnnotations != "" && (status == http.StatusOK || status == http.StatusCreated) {
+		w.apply(`odata.include-annotations="` + w.prefs.IncludeAnnotations + `"`)
+	}
+	if len(w.applied) > 0 {
+		w.Header().Set("Preference-Applied", strings.Join(w.applied, ", "))
+	}
+	if w.metadata != MetadataMinimal && w.Header().Get("Content-Type") == "application/json" {
+		w.Header().Set("Content-Type", "application/json;odata.metadata="+w.metadata)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *preferenceResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *preferenceResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *preferenceResponseWriter) apply(preference string) {
+	w.applied = append(w.applied, preference)
+}
+
+// responsePreferences finds the preferences attached to w by
+// withPreferences, looking through wrapping response writers.
+func responsePreferences(w http.ResponseWriter) *preferenceResponseWriter {
+	for {
+		switch v := w.(type) {
+		case *preferenceResponseWriter:
+			return v
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// preferMinimal reports whether the response to a data modification request
+// should omit the payload, and records the applied return preference.
+func preferMinimal(w http.ResponseWriter) bool {
+	pw := responsePreferences(w)
+	if pw == nil || (pw.method != http.MethodPost && pw.method != http.MethodPatch && pw.method != http.MethodPut) {
+		return false
+	}
+	switch pw.prefs.Return {
+	case "minimal":
+		pw.apply("return=minimal")
+		return true
+	case "representation":
+		pw.apply("return=representation")
+	}
+	return false
+}
+
+// filterInstanceAnnotations drops the instance annotations of v that are not
+// selected by the odata.include-annotations preference of the response.
+// Control information is always kept.
+func filterInstanceAnnotations(w http.ResponseWriter, v interface{}) interface{} {
+	pw := responsePreferences(w)
+	if pw == nil || pw.prefs.IncludeAnnotations == "" {
+		return v
+	}
+	return filterAnnotations(v, pw.prefs.IncludeAnnotations)
+}
+
+func filterAnnotations(v interface{}, pattern string) interface{} {
+	switch value := v.(type) {
+	case OrderedFields:
+		filtered := OrderedFields{EntityName: value.EntityName, Fields: make([]struct{Key string; Value interface{}}, 0, len(value.Fields))}
+		for _, field := range value.Fields {
+			if _, term, ok := strings.Cut(field.Key, "@"); ok && isInstanceAnnotation(term) && !includeAnnotation(pattern, term) {
+				continue
+			}
+			filtered.Fields = append(filtered.Fields, struct{Key string; Value interface{}}{field.Key, filterAnnotations(field.Value, pattern)})
+		}
+		return filtered
+	case []OrderedFields:
+		filtered := make([]OrderedFields, len(value))
+		for i, entity := range value {
+			filtered[i] = filterAnnotations(entity, pattern).(OrderedFields)
+		}
+		return filtered
+	case []interface{}:
+		filtered := make([]interface{}, len(value))
+		for i, entity := range value {
+			filtered[i] = filterAnnotations(entity, pattern)
+		}
+		return filtered
+	}
+	return v
+}
+
+// isInstanceAnnotation tells instance annotations, whose terms are namespace
+// qualified, from control information such as odata.etag or removed.
+func isInstanceAnnotation(term string) bool {
+	return strings.Contains(term, ".") && !strings.HasPrefix(term, "odata.")
+}
+
+// includeAnnotation evaluates an odata.include-annotations pattern list for
+// term. The most specific matching pattern wins and, between equally specific
+// patterns, exclusion wins.
+func includeAnnotation(pattern, term string) bool {
+	term, _, _ = strings.Cut(term, "#")
+	include := false
+	specificity := -1
+	for _, p := range strings.Split(pattern, ",") {
+		p = strings.TrimSpace(p)
+		exclude := strings.HasPrefix(p, "-")
+		p = strings.TrimPrefix(p, "-")
+
+		var s int
+		switch {
+		case p == "*":
+			s = 0
+		case strings.HasSuffix(p, ".*") && strings.HasPrefix(term, strings.TrimSuffix(p, "*")):
+			s = 1
+		case p == term:
+			s = 2
+		default:
+			continue
+		}
+		if s > specificity || (s == specificity && exclude) {
+			include = !exclude
+			specificity = s
+		}
+	}
+	return include
+}
@@ -0,0 +1,158 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePreferences(t *testing.T) {
+	prefs := ParsePreferences([]string{
+		`return=minimal, odata.include-annotations="display.*,-display.secret"`,
+		`respond-async; wait=10, return=representation`,
+	})
+	assert.Equal(t, "minimal", prefs.Return)
+	assert.Equal(t, "display.*,-display.secret", prefs.IncludeAnnotations)
+	assert.True(t, prefs.RespondAsync)
+	_, ok := prefs.Get("odata.track-changes")
+	assert.False(t, ok)
+}
+
+func TestIncludeAnnotation(t *testing.T) {
+	assert.True(t, includeAnnotation("*", "com.example.flag"))
+	assert.False(t, includeAnnotation("-*", "com.example.flag"))
+	assert.True(t, includeAnnotation("display.*", "display.label"))
+	assert.False(t, includeAnnotation("display.*", "com.example.flag"))
+	assert.False(t, includeAnnotation("display.*,-display.secret", "display.secret"))
+	assert.True(t, includeAnnotation("-*,com.example.flag", "com.example.flag#q"))
+	assert.False(t, includeAnnotation("*,-*", "com.example.flag"))
+}
+
+func TestPreferReturn(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## prefer_test - TestPreferReturn")
+	fmt.Println("")
+	r := setupOrderRouter()
+
+	t.Run("Create with return=minimal", func(t *testing.T) {
+		resetTestOrders()
+		req, _ := http.NewRequest("POST", "/odata/v4/Orders", strings.NewReader(`{"ID":"O2","Customer":"Initech"}`))
+		req.Header.Set("Prefer", "return=minimal")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "Orders('O2')", w.Header().Get("OData-EntityId"))
+		assert.Equal(t, "Orders('O2')", w.Header().Get("Location"))
+		assert.Equal(t, "return=minimal", w.Header().Get("Preference-Applied"))
+		assert.Empty(t, w.Body.String())
+		assert.Len(t, testOrders, 2)
+	})
+
+	t.Run("Update with return=minimal", func(t *testing.T) {
+		resetTestOrders()
+		req, _ := http.NewRequest("PATCH", "/odata/v4/Orders('O1')", strings.NewReader(`{"Customer":"Globex"}`))
+		req.Header.Set("Prefer", "return=minimal")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "Orders('O1')", w.Header().Get("OData-EntityId"))
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, "Globex", testOrders[0].Customer)
+	})
+
+	t.Run("Update with return=representation", func(t *testing.T) {
+		resetTestOrders()
+		req, _ := http.NewRequest("PATCH", "/odata/v4/Orders('O1')", strings.NewReader(`{"Customer":"Globex"}`))
+		req.Header.Set("Prefer", "return=representation")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "return=representation", w.Header().Get("Preference-Applied"))
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "Globex", response["Customer"])
+	})
+
+	t.Run("Delta payload with return=minimal", func(t *testing.T) {
+		resetTestOrders()
+		req, _ := http.NewRequest("PATCH", "/odata/v4/OrderItems", strings.NewReader(`{"value":[{"@id":"OrderItems('1')","Quantity":5}]}`))
+		req.Header.Set("Prefer", "return=minimal")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, 5, testOrderItems[0].Quantity)
+	})
+
+	t.Run("Reads ignore return preference", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Products/1", nil)
+		req.Header.Set("Prefer", "return=minimal")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Preference-Applied"))
+	})
+}
+
+func TestPreferIncludeAnnotations(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## prefer_test - TestPreferIncludeAnnotations")
+	fmt.Println("")
+	r := setupTestRouter()
+	RegisterEntity(TestVersionedNote{}, EntityHandler{
+		GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {
+			CreateODataResponse(w, "Notes", []OrderedFields{{
+				EntityName: "Notes",
+				Fields: []struct{Key string; Value interface{}}{
+					{Key: "@odata.etag", Value: `W/"1"`},
+					{Key: "@com.example.flag", Value: true},
+					{Key: "ID", Value: "1"},
+					{Key: "Text@display.label", Value: "Note text"},
+					{Key: "Text", Value: "a"},
+				},
+			}})
+		},
+	})
+
+	get := func(prefer string) map[string]interface{} {
+		req, _ := http.NewRequest("GET", "/odata/v4/Notes", nil)
+		if prefer != "" {
+			req.Header.Set("Prefer", prefer)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		if prefer != "" {
+			assert.Equal(t, prefer, w.Header().Get("Preference-Applied"))
+		}
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response["value"].([]interface{})[0].(map[string]interface{})
+	}
+
+	note := get("")
+	assert.Contains(t, note, "@com.example.flag")
+	assert.Contains(t, note, "Text@display.label")
+
+	note = get(`odata.include-annotations="display.*"`)
+	assert.NotContains(t, note, "@com.example.flag")
+	assert.Contains(t, note, "Text@display.label")
+	assert.Contains(t, note, "@odata.etag")
+
+	note = get(`odata.include-annotations="-*"`)
+	assert.NotContains(t, note, "@com.example.flag")
+	assert.NotContains(t, note, "Text@display.label")
+	assert.Equal(t, "a", note["Text"])
+}
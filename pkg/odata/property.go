@@ -0,0 +1,37 @@
+package odata
+
+import (
+	"reflect"
+	"strings"
+)
+
+// propertyName returns the OData name of a struct field: the name of its json
+// tag, else the name given with odata:"name:...", else the field name.
+// Navigation properties are named after the relationship in their
+// odata:"expand:..." option, which is how expanded entities are keyed.
+func propertyName(field reflect.StructField) string {
+	if name := fieldTags(field).Expand; name != "" {
+		return name
+	}
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	if name := fieldTags(field).Name; name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// isProperty reports whether a struct field is exposed as an OData property.
+// Unexported fields and fields tagged json:"-" are hidden.
+func isProperty(field reflect.StructField) bool {
+	return field.IsExported() && field.Tag.Get("json") != "-"
+}
+
+// jsonName returns the name encoding/json uses for a struct field.
+func jsonName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
@@ -0,0 +1,103 @@
+package odata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestContacts struct {
+	ID       string `json:"id" odata:"key"`
+	Name     string `json:"name"`
+	Email    string `odata:"name:email"`
+	Password string `json:"-"`
+	internal string
+}
+
+func (c TestContacts) EntityName() string {
+	return "Contacts"
+}
+
+func (c TestContacts) GetRelationships() map[string]string {
+	return map[string]string{}
+}
+
+type TestContactHandler struct {
+	created *TestContacts
+}
+
+func (h *TestContactHandler) CreateEntity(entity interface{}) (interface{}, error) {
+	contact := entity.(TestContacts)
+	h.created = &contact
+	return contact, nil
+}
+
+var testContacts = []TestContacts{
+	{ID: "1", Name: "Ann", Email: "ann@example.com", Password: "secret", internal: "x"},
+	{ID: "2", Name: "Bob", Email: "bob@example.com", Password: "secret", internal: "y"},
+}
+
+func TestPropertyNames(t *testing.T) {
+	entity := EntityToOrderedFields(testContacts[0], "")
+	assert.Equal(t, []string{"id", "name", "email"}, fieldKeys(entity))
+
+	assert.Equal(t, map[string]interface{}{"id": "1", "name": "Ann", "email": "ann@example.com"}, EntityToMap(testContacts[0], ""))
+}
+
+func TestPropertyNamesInMetadata(t *testing.T) {
+	RegisterEntity(TestContacts{}, EntityHandler{})
+	contacts := BuildMetadata().Schema("CatalogService").EntityType("Contacts")
+
+	assert.Equal(t, "id", contacts.Key.PropertyRefs[0].Name)
+	assert.Equal(t, "Edm.String", contacts.Property("email").Type)
+	assert.Nil(t, contacts.Property("Password"))
+	assert.Nil(t, contacts.Property("internal"))
+}
+
+func TestPropertyNamesInQueries(t *testing.T) {
+	filtered, err := ApplyFilter(testContacts, "$filter="+strings.ReplaceAll("email eq 'bob@example.com'", " ", "%20"))
+	assert.NoError(t, err)
+	assert.Len(t, filtered, 1)
+
+	selected := ApplySelect(filtered, "$select=email").([]OrderedFields)
+	assert.Equal(t, []string{"email"}, fieldKeys(selected[0]))
+}
+
+func TestPropertyNamesInPayload(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## property_test - TestPropertyNamesInPayload")
+	fmt.Println("")
+	r := chi.NewRouter()
+	handler := &TestContactHandler{}
+	RegisterEntity(TestContacts{}, EntityHandler{EntityCreator: handler})
+	RegisterRoutes(r)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/odata/v4/Contacts", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(`{"id": "3", "name": "Cid", "email": "cid@example.com"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, &TestContacts{ID: "3", Name: "Cid", Email: "cid@example.com"}, handler.created)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "cid@example.com", response["email"])
+	assert.NotContains(t, response, "Password")
+
+	// Hidden fields cannot be written
+	w = post(`{"id": "4", "Password": "secret"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -1,10 +1,14 @@
 package odata
 
 import (
+	"fmt"
 	"log"
+	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
+
+	"github.com/go-chi/chi/v5"
 )
 
 func ApplySkipTop(entities interface{}, skip, top string) interface{} {
@@ -55,61 +59,317 @@ func ApplyExpand(entities interface{}, expand string, handler ExpandHandler) int
 	}
 }
 
+// MaxExpandLevels bounds recursive expansion requested with $levels=max.
+var MaxExpandLevels = 10
+
 func ApplyExpandSingle(entity interface{}, expand string, handler ExpandHandler) OrderedFields {
-    var result OrderedFields
-
-    // Convert entity to OrderedFields if it's not already
-    switch v := entity.(type) {
-    case OrderedFields:
-        result = v
-    default:
-        result = EntityToOrderedFields(entity, expand)
-    }
+	result := toOrderedFields(entity, expand)
+	if expand == "" {
+		return result
+	}
 
-    if expand == "" {
-        return result
-    }
+	// Track the entities on the current expansion path so that
+	// self-referencing relationships cannot loop forever.
+	path := make(map[string]bool)
+	if identity := entityReference(result); identity != "" {
+		path[identity] = true
+	}
+	return applyExpandSingle(result, expand, handler, path)
+}
 
-    expandParts := parseExpandQuery(expand)
-    for relationshipName, nestedExpand := range expandParts {
-        if nestedExpand != "" {
-            log.Printf("Processing relationship: %s with nested expand: %s", relationshipName, nestedExpand)
-        }
-        expandedEntity := handler.ExpandEntity(result, relationshipName, nestedExpand)
-        if expandedEntity != nil {
-            // Remove the existing field if it exists
-            for i, field := range result.Fields {
-                if field.Key == relationshipName {
-                    result.Fields = append(result.Fields[:i], result.Fields[i+1:]...)
-                    break
-                }
-            }
+func applyExpandSingle(result OrderedFields, expand string, handler ExpandHandler, path map[string]bool) OrderedFields {
+	if expand == "" || handler == nil {
+		return result
+	}
 
-            // Convert the expanded entity to OrderedFields if necessary
-            var expandedOrderedFields interface{}
-            if reflect.TypeOf(expandedEntity).Kind() == reflect.Slice {
-                log.Printf("Expanded entity is a slice")
-                expandedSlice := reflect.ValueOf(expandedEntity)
-                expandedOrderedFieldsSlice := make([]OrderedFields, expandedSlice.Len())
-                for i := 0; i < expandedSlice.Len(); i++ {
-                    nestedHandler := getHandlerForEntity(expandedSlice.Index(i).Interface())
-                    expandedOrderedFieldsSlice[i] = ApplyExpandSingle(expandedSlice.Index(i).Interface(), nestedExpand, nestedHandler)
-                }
-                expandedOrderedFields = expandedOrderedFieldsSlice
-            } else {
-                log.Printf("Expanded entity is not a slice")
-                nestedHandler := getHandlerForEntity(expandedEntity)
-                expandedOrderedFields = ApplyExpandSingle(expandedEntity, nestedExpand, nestedHandler)
-            }
+	expandParts := expandWildcards(result.EntityName, parseExpandQuery(expand))
+	for relationshipName, nestedExpand := range expandParts {
+		if strings.HasSuffix(relationshipName, "/$ref") {
+			result = expandReferences(result, strings.TrimSuffix(relationshipName, "/$ref"), handler)
+			continue
+		}
+		levels, nestedExpand, err := parseExpandLevels(nestedExpand)
+		if err != nil {
+			// Rejected by ValidateExpand for registered routes
+			log.Printf("Ignoring $levels of %s.%s: %v", result.EntityName, relationshipName, err)
+		}
+		if nestedExpand != "" {
+			log.Printf("Processing relationship: %s with nested expand: %s", relationshipName, nestedExpand)
+		}
+		if levels != 1 && !isRecursiveRelationship(result.EntityName, relationshipName) {
+			log.Printf("Ignoring $levels for non-recursive relationship %s.%s", result.EntityName, relationshipName)
+			levels = 1
+		}
+		if levels == -1 {
+			levels = MaxExpandLevels
+		}
+		result = expandRelationship(result, relationshipName, nestedExpand, levels, handler, path)
+	}
 
-            // Add the expanded result
-            result.Fields = append(result.Fields, struct{Key string; Value interface{}}{Key: relationshipName, Value: expandedOrderedFields})
-        } else {
-            log.Printf("ExpandEntity returned nil for %s", relationshipName)
-        }
-    }
+	return result
+}
 
-    return result
+// expandRelationship replaces relationshipName on result with the entities
+// returned by handler. levels greater than one expands the same relationship
+// again on every related entity.
+func expandRelationship(result OrderedFields, relationshipName, nestedExpand string, levels int, handler ExpandHandler, path map[string]bool) OrderedFields {
+	expandedEntity := handler.ExpandEntity(result, relationshipName, nestedExpand)
+	if expandedEntity == nil {
+		log.Printf("ExpandEntity returned nil for %s", relationshipName)
+		return result
+	}
+
+	// Remove the existing field if it exists
+	for i, field := range result.Fields {
+		if field.Key == relationshipName {
+			result.Fields = append(result.Fields[:i], result.Fields[i+1:]...)
+			break
+		}
+	}
+
+	expandChild := func(child interface{}) OrderedFields {
+		nestedHandler := getHandlerForEntity(child)
+		childFields := toOrderedFields(child, nestedExpand)
+
+		// Only recursion driven by $levels can revisit an entity indefinitely;
+		// literal nested expands are bounded by the expand string itself.
+		identity := ""
+		if levels != 1 {
+			identity = entityReference(childFields)
+		}
+		if identity != "" {
+			if path[identity] {
+				log.Printf("Stopping expansion of %s: cycle detected at %s", relationshipName, identity)
+				return childFields
+			}
+			path[identity] = true
+			defer delete(path, identity)
+		}
+
+		childFields = applyExpandSingle(childFields, nestedExpand, nestedHandler, path)
+		if levels > 1 {
+			childFields = expandRelationship(childFields, relationshipName, nestedExpand, levels-1, nestedHandler, path)
+		}
+		return childFields
+	}
+
+	// Convert the expanded entity to OrderedFields if necessary
+	var expandedOrderedFields interface{}
+	if reflect.TypeOf(expandedEntity).Kind() == reflect.Slice {
+		log.Printf("Expanded entity is a slice")
+		expandedSlice := reflect.ValueOf(expandedEntity)
+		expandedOrderedFieldsSlice := make([]OrderedFields, expandedSlice.Len())
+		for i := 0; i < expandedSlice.Len(); i++ {
+			expandedOrderedFieldsSlice[i] = expandChild(expandedSlice.Index(i).Interface())
+		}
+		expandedOrderedFields = expandedOrderedFieldsSlice
+	} else {
+		log.Printf("Expanded entity is not a slice")
+		expandedOrderedFields = expandChild(expandedEntity)
+	}
+
+	// Add the expanded result
+	result.Fields = append(result.Fields, struct{Key string; Value interface{}}{Key: relationshipName, Value: expandedOrderedFields})
+	return result
+}
+
+// expandWildcards replaces * and */$ref with an entry for every relationship
+// registered for entityName. Explicitly named relationships take precedence.
+func expandWildcards(entityName string, expandParts map[string]string) map[string]string {
+	result := make(map[string]string, len(expandParts))
+	for relationshipName, nestedExpand := range expandParts {
+		if relationshipName == "*" || relationshipName == "*/$ref" {
+			continue
+		}
+		result[relationshipName] = nestedExpand
+	}
+
+	for _, wildcard := range []string{"*", "*/$ref"} {
+		nestedExpand, ok := expandParts[wildcard]
+		if !ok {
+			continue
+		}
+		suffix := strings.TrimPrefix(wildcard, "*")
+		for relationshipName := range entityRelationships[entityName] {
+			if isNoExpand(entityName, relationshipName) {
+				continue
+			}
+			_, named := result[relationshipName]
+			_, namedRef := result[relationshipName+"/$ref"]
+			if !named && !namedRef {
+				result[relationshipName+suffix] = nestedExpand
+			}
+		}
+	}
+	return result
+}
+
+// expandReferences expands relationshipName on result as entity references,
+// replacing every related entity with its @odata.id.
+func expandReferences(result OrderedFields, relationshipName string, handler ExpandHandler) OrderedFields {
+	result = expandRelationship(result, relationshipName, "", 1, handler, nil)
+	for i, field := range result.Fields {
+		if field.Key != relationshipName {
+			continue
+		}
+		switch v := field.Value.(type) {
+		case OrderedFields:
+			result.Fields[i].Value = entityReferenceFields(v)
+		case []OrderedFields:
+			references := make([]OrderedFields, len(v))
+			for j, related := range v {
+				references[j] = entityReferenceFields(related)
+			}
+			result.Fields[i].Value = references
+		}
+	}
+	return result
+}
+
+func entityReferenceFields(entity OrderedFields) OrderedFields {
+	return OrderedFields{
+		EntityName: entity.EntityName,
+		Fields: []struct{Key string; Value interface{}}{
+			{Key: "@odata.id", Value: entityReference(entity)},
+		},
+	}
+}
+
+func toOrderedFields(entity interface{}, expand string) OrderedFields {
+	if orderedFields, ok := entity.(OrderedFields); ok {
+		return orderedFields
+	}
+	return EntityToOrderedFields(entity, expand)
+}
+
+// parseExpandLevels extracts $levels from the options of an expand item. It
+// returns 1 when $levels is absent and -1 for $levels=max, together with the
+// remaining options. Values other than max and positive integers are
+// reported in the error and leave levels at 1.
+func parseExpandLevels(options string) (int, string, error) {
+	levels := 1
+	var remaining []string
+	var invalid error
+	for _, option := range splitTopLevel(options, ';') {
+		if !strings.HasPrefix(option, "$levels=") {
+			remaining = append(remaining, option)
+			continue
+		}
+		value := strings.TrimPrefix(option, "$levels=")
+		if value == "max" {
+			levels = -1
+		} else if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			levels = n
+		} else {
+			invalid = fmt.Errorf("invalid $levels %q: must be a positive integer or max", value)
+		}
+	}
+	return levels, strings.Join(remaining, ";"), invalid
+}
+
+// ValidateExpand checks the $expand option of query on entitySet, including
+// the options nested in it, for values ApplyExpand cannot apply, such as
+// $levels=0, and for navigation properties tagged odata:"noexpand". An empty
+// entitySet skips the noexpand check. Routes registered by RegisterRoutes
+// answer 400 Bad Request for these errors.
+func ValidateExpand(entitySet, query string) error {
+	for relationshipName, nestedExpand := range parseExpandQuery(query) {
+		navigationName := strings.TrimSuffix(relationshipName, "/$ref")
+		if isNoExpand(entitySet, navigationName) {
+			return fmt.Errorf("$expand=%s: %s cannot be expanded", relationshipName, navigationName)
+		}
+		if navigationName != relationshipName {
+			continue
+		}
+		_, nestedExpand, err := parseExpandLevels(nestedExpand)
+		if err != nil {
+			return fmt.Errorf("$expand=%s: %w", relationshipName, err)
+		}
+		target := ""
+		if relInfo, ok := entityRelationships[entitySet][relationshipName]; ok {
+			target = relInfo.TargetEntity
+		}
+		if err := ValidateExpand(target, nestedExpand); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isNoExpand reports whether the navigation property relationshipName of
+// entitySet is tagged odata:"noexpand".
+func isNoExpand(entitySet, relationshipName string) bool {
+	entityType, ok := lookupEntityType(entitySet)
+	if !ok {
+		return false
+	}
+	property, ok := modelOf(reflect.TypeOf(entityType)).Property(relationshipName)
+	return ok && property.tags.NoExpand
+}
+
+// withValidExpand answers 400 Bad Request for requests whose $expand fails
+// ValidateExpand.
+func withValidExpand(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := ValidateExpand(chi.URLParam(r, "entitySet"), r.URL.RawQuery); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isRecursiveRelationship reports whether relationshipName leads from
+// entityName back to entityName, as $levels requires.
+func isRecursiveRelationship(entityName, relationshipName string) bool {
+	relInfo, ok := entityRelationships[entityName][relationshipName]
+	return ok && relInfo.TargetEntity == entityName
+}
+
+// entityReference returns the canonical URL of the entity relative to the
+// service root, such as Products('1'), or "" if the entity has no registered
+// key.
+func entityReference(entity OrderedFields) string {
+	keyFields := entityKeyFields(entity.EntityName)
+	if len(keyFields) == 0 {
+		return ""
+	}
+	values := make(map[string]interface{})
+	for _, field := range entity.Fields {
+		values[field.Key] = field.Value
+	}
+
+	var predicates []string
+	for _, keyField := range keyFields {
+		value, ok := values[keyField]
+		if !ok {
+			return ""
+		}
+		if len(keyFields) == 1 {
+			predicates = append(predicates, formatKeyValue(value))
+		} else {
+			predicates = append(predicates, keyField+"="+formatKeyValue(value))
+		}
+	}
+	return entity.EntityName + "(" + strings.Join(predicates, ",") + ")"
+}
+
+// formatKeyValue formats a key value as a URL literal, quoting strings.
+func formatKeyValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	return fmt.Sprint(value)
+}
+
+// entityKeyFields returns the property names of the fields tagged as key on
+// the registered entity type.
+func entityKeyFields(entityName string) []string {
+	model, ok := LookupEntityModel(entityName)
+	if !ok {
+		return nil
+	}
+	return model.Keys
 }
 
 func getHandlerForEntity(entity interface{}) ExpandHandler {
@@ -280,7 +540,7 @@ func ApplySelect(entities interface{}, selectQuery string) interface{} {
 				result = append(result, selectedEntity)
 			} else {
 				entity := entitiesValue.Index(i).Interface()
-				selectedEntity := ApplySelectSingle(entity.(OrderedFields), selectedFields)
+				selectedEntity := ApplySelectSingle(toOrderedFields(entity, ""), selectedFields)
 				result = append(result, selectedEntity)
 			}
 		}
@@ -301,16 +561,33 @@ func ApplySelectSingle(entity OrderedFields, selectedFields []string) OrderedFie
 	}
 
 	result := OrderedFields{EntityName: entity.EntityName}
+	// "*" selects all structural properties. Qualified wildcards such as
+	// CatalogService.* select the bound operations, which are not part of
+	// the payload, so they never match a field below.
+	selectAll := false
+	for _, selectedField := range selectedFields {
+		if selectedField == "*" {
+			selectAll = true
+		}
+	}
 
 	for _, field := range entity.Fields {
 		log.Printf("ApplySelectSingle: Processing field: %s, Type: %T, Value: %v", field.Key, field.Value, field.Value)
-		if isExpandedEntity(field.Value) {
+		if strings.HasPrefix(field.Key, "@") {
+			// Control information such as @odata.etag is not subject to $select
+			result.Fields = append(result.Fields, field)
+		} else if isExpandedEntity(field.Value) {
 			log.Printf("ApplySelectSingle: Field %s is an expanded entity", field.Key)
 			result.Fields = append(result.Fields, field)
+		} else if selectAll {
+			result.Fields = append(result.Fields, field)
 		} else {
+			// Property annotations such as Datasheet@odata.mediaReadLink
+			// follow the property they annotate
+			propertyName, _, _ := strings.Cut(field.Key, "@")
 			for _, selectedField := range selectedFields {
 				fieldParts := strings.Split(selectedField, "/")
-				if strings.EqualFold(field.Key, fieldParts[0]) {
+				if strings.EqualFold(propertyName, fieldParts[0]) {
 					if len(fieldParts) > 1 {
 						log.Printf("ApplySelectSingle: Handling nested selection for field: %s", field.Key)
 						switch v := field.Value.(type) {
@@ -378,33 +655,12 @@ func EntityToMap(entity interface{}, expand string) map[string]interface{} {
 
 	// Handle struct types
 	if entityValue.Kind() == reflect.Struct {
-		for i := 0; i < entityValue.NumField(); i++ {
-			field := entityType.Field(i)
-			value := entityValue.Field(i).Interface()
-
-			// Parse the json tag
-			jsonTag := field.Tag.Get("json")
-			if jsonTag == "" {
-				// If no json tag, use the field name
-				result[field.Name] = value
-				continue
-			}
-
-			// Split the json tag
-			parts := strings.Split(jsonTag, ",")
-			key := parts[0]
-
-			// If the key is "-", skip this field
-			if key == "-" {
-				continue
-			}
-
-			// If the key is empty, use the field name
-			if key == "" {
-				key = field.Name
-			}
+		for _, property := range modelOf(entityType).Properties {
+			value := property.Value(entityValue).Interface()
+			key := property.Name
 
 			// Check for omitempty
+			parts := strings.Split(property.Field.Tag.Get("json"), ",")
 			if len(parts) > 1 && parts[1] == "omitempty" {
 				// Only include non-zero values
 				if !isZeroValue(value) {
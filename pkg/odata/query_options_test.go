@@ -25,7 +25,7 @@ func TestGetProductsWithSkipAndTop(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "$metadata#Products", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
+	assert.Equal(t, "/odata/v4/$metadata#Products", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
 
 	values, ok := response["value"].([]interface{})
 	assert.True(t, ok, "Expected value to be a slice, got %T", response["value"])
@@ -51,7 +51,7 @@ func TestGetProductsWithSelect(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "$metadata#Products", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
+	assert.Equal(t, "/odata/v4/$metadata#Products(ID,Name)", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
 
 	values, ok := response["value"].([]interface{})
 	assert.True(t, ok, "Expected value to be a slice, got %T", response["value"])
@@ -93,7 +93,7 @@ func TestGetProductWithSelect(t *testing.T) {
 			err := json.Unmarshal(w.Body.Bytes(), &response)
 			assert.NoError(t, err)
 
-			assert.Equal(t, "$metadata#Products/$entity", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
+			assert.Equal(t, "/odata/v4/$metadata#Products(ID,Price)/$entity", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
 
 			assert.Len(t, response, 3, "Expected 3 fields in response, got %d: %v", len(response), response)
 			assert.Contains(t, response, "ID", "Expected 'ID' field in response")
@@ -119,7 +119,7 @@ func TestGetProductWithExpandAndSelect(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	assert.NoError(t, err)
 
-	assert.Equal(t, "$metadata#Products/$entity", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
+	assert.Equal(t, "/odata/v4/$metadata#Products(ID,Description,Category(),Supplier())/$entity", response["@odata.context"], "Unexpected @odata.context: %v", response["@odata.context"])
 
 	assert.Contains(t, response, "ID", "Expected 'ID' field in response")
 	assert.Contains(t, response, "Description", "Expected 'Description' field in response")
@@ -139,4 +139,41 @@ func TestGetProductWithExpandAndSelect(t *testing.T) {
 
 	assert.NotContains(t, response, "Name", "Unexpected 'Name' field in response")
 	assert.NotContains(t, response, "Price", "Unexpected 'Price' field in response")
-}
\ No newline at end of file
+}
+func TestGetProductWithSelectWildcard(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## query_options_test - TestGetProductWithSelectWildcard")
+	fmt.Println("")
+	r := setupTestRouter()
+
+	testCases := []struct {
+		name           string
+		url            string
+		expectedFields []string
+	}{
+		{"All properties", "/odata/v4/Products(1)?$select=*", []string{"ID", "Name", "Description", "Price", "Category_ID", "Supplier_ID"}},
+		{"Namespace wildcard selects no properties", "/odata/v4/Products(1)?$select=CatalogService.*,Name", []string{"Name"}},
+		{"All properties with expand", "/odata/v4/Products(1)?$select=*&$expand=Category", []string{"ID", "Name", "Description", "Price", "Category_ID", "Supplier_ID", "Category"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tc.url, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code, "Expected status code %d, got %d", http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			delete(response, "@odata.context")
+			assert.Len(t, response, len(tc.expectedFields), "Unexpected fields in response: %v", response)
+			for _, field := range tc.expectedFields {
+				assert.Contains(t, response, field)
+			}
+			assert.NotContains(t, response, "*")
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEntityRef(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## ref_test - TestGetEntityRef")
+	fmt.Println("")
+	r := setupTestRouter()
+
+	t.Run("Single-valued relationship", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Products(1)/Category/$ref", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "/odata/v4/$metadata#$ref", response["@odata.context"])
+		assert.Equal(t, "Categories('1')", response["@odata.id"])
+	})
+
+	t.Run("Collection-valued relationship", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Categories(1)/Products/$ref", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Equal(t, "/odata/v4/$metadata#Collection($ref)", response["@odata.context"])
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"@odata.id": "Products('1')"},
+			map[string]interface{}{"@odata.id": "Products('2')"},
+		}, response["value"])
+	})
+
+	t.Run("Unknown relationship", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Products(1)/Unknown/$ref", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestModifyEntityRef(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## ref_test - TestModifyEntityRef")
+	fmt.Println("")
+	r := setupTestRouter()
+
+	original := make([]TestProducts, len(testProducts))
+	copy(original, testProducts)
+	defer func() { testProducts = original }()
+
+	t.Run("Reassign category with PUT", func(t *testing.T) {
+		body := strings.NewReader(`{"@odata.id":"http://localhost/odata/v4/Categories('2')"}`)
+		req, _ := http.NewRequest("PUT", "/odata/v4/Products(1)/Category/$ref", body)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		assert.Equal(t, "2", testProducts[0].Category_ID)
+	})
+
+	t.Run("Reference to the wrong entity set", func(t *testing.T) {
+		body := strings.NewReader(`{"@odata.id":"Suppliers('2')"}`)
+		req, _ := http.NewRequest("PUT", "/odata/v4/Products(1)/Category/$ref", body)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Add to collection with POST", func(t *testing.T) {
+		body := strings.NewReader(`{"@odata.id":"Products('3')"}`)
+		req, _ := http.NewRequest("POST", "/odata/v4/Categories(1)/Products/$ref", body)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		assert.Equal(t, "1", testProducts[2].Category_ID)
+	})
+
+	t.Run("Remove from collection", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/odata/v4/Categories(1)/Products('3')/$ref", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		assert.Equal(t, "", testProducts[2].Category_ID)
+	})
+
+	t.Run("Remove from collection with $id", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/odata/v4/Categories(1)/Products/$ref?$id=../../Products('2')", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		assert.Equal(t, "", testProducts[1].Category_ID)
+	})
+
+	t.Run("Remove from collection with key as segment", func(t *testing.T) {
+		testProducts[0].Category_ID = "1"
+		req, _ := http.NewRequest("DELETE", "/odata/v4/Categories/1/Products/1/$ref", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		assert.Equal(t, "", testProducts[0].Category_ID)
+	})
+
+	t.Run("Unbind single-valued relationship", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/odata/v4/Products(1)/Supplier/$ref", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		assert.Equal(t, "", testProducts[0].Supplier_ID)
+	})
+
+	t.Run("Unbound relationship reads as no content", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/odata/v4/Products(1)/Supplier/$ref", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+}
@@ -1,33 +1,72 @@
 package odata
 
 import (
+	"fmt"
 	"log"
+	"reflect"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// RegisterEntity registers entity and the handler serving its entity set.
+// Like chi does for invalid routes, it panics when the odata tags of the
+// entity are invalid, so that a typo such as odata:"mexlength:30" cannot go
+// unnoticed.
 func RegisterEntity(entity Entity, handler EntityHandler) {
 	entityName := entity.EntityName()
+	if err := ValidateEntityTags(entity); err != nil {
+		panic(fmt.Sprintf("odata: invalid tags on entity %s: %v", entityName, err))
+	}
+	modelOf(reflect.TypeOf(entity))
+	invalidateMetadata()
 	entityHandlers[entityName] = handler
 	entityTypes = append(entityTypes, entity)
 	log.Printf("Registered entity: %s", entityName)
 }
 
 func RegisterEntityRelationship(entityName, relationshipName, targetEntityName, relationType string) {
-	if entityRelationships[entityName] == nil {
-		entityRelationships[entityName] = make(map[string]RelationshipInfo)
-	}
-	entityRelationships[entityName][relationshipName] = RelationshipInfo{
-		TargetEntity: targetEntityName,
-		Type:         relationType,
-	}
-	log.Printf("Registered relationship: %s.%s -> %s (%s)", entityName, relationshipName, targetEntityName, relationType)
+	RegisterEntityRelationshipWithOptions(entityName, relationshipName, targetEntityName, relationType, RelationshipOptions{})
 }
 
 func RegisterRoutes(router *chi.Mux) {
-	router.Get("/odata/v4/$metadata", handleGetMetadata)
-	router.Get("/odata/v4/{entitySet}", handleGetEntity)
-	router.Get("/odata/v4/{entitySet}({id})", handleGetEntityByID)
-	router.Get("/odata/v4/{entitySet}/{id}", handleGetEntityByID)
+	router.Group(func(r chi.Router) {
+		r.Use(withPreferences)
+		r.Get("/odata/v4/$async/{id}", handleGetAsyncStatus)
+		r.Delete("/odata/v4/$async/{id}", handleDeleteAsyncStatus)
+	})
+	router.Group(func(r chi.Router) {
+		r.Use(withPreferences, withAsync, withValidExpand)
+		r.Get("/odata/v4", handleGetServiceDocument)
+		r.Get("/odata/v4/", handleGetServiceDocument)
+		r.Get("/odata/v4/$metadata", handleGetMetadata)
+		r.Get("/odata/v4/openapi.json", handleGetOpenAPI)
+		r.Get("/odata/v4/{entitySet}", handleGetEntity)
+		r.Post("/odata/v4/{entitySet}", handleCreateEntity)
+		r.Get("/odata/v4/{entitySet}({id})", handleGetEntityByID)
+		r.Get("/odata/v4/{entitySet}/{id}", handleGetEntityByID)
+		r.Get("/odata/v4/{entitySet}({id})/$value", handleGetMediaValue)
+		r.Get("/odata/v4/{entitySet}/{id}/$value", handleGetMediaValue)
+		r.Put("/odata/v4/{entitySet}({id})/$value", handlePutMediaValue)
+		r.Put("/odata/v4/{entitySet}/{id}/$value", handlePutMediaValue)
+		r.Get("/odata/v4/{entitySet}({id})/{property}", handleGetProperty)
+		r.Get("/odata/v4/{entitySet}/{id}/{property}", handleGetProperty)
+		r.Put("/odata/v4/{entitySet}({id})/{property}", handlePutStreamProperty)
+		r.Put("/odata/v4/{entitySet}/{id}/{property}", handlePutStreamProperty)
+		r.Patch("/odata/v4/{entitySet}", handleUpdateCollection)
+		r.Patch("/odata/v4/{entitySet}({id})", handleUpdateEntity)
+		r.Patch("/odata/v4/{entitySet}/{id}", handleUpdateEntity)
+		r.Delete("/odata/v4/{entitySet}({id})", handleDeleteEntity)
+		r.Delete("/odata/v4/{entitySet}/{id}", handleDeleteEntity)
+		r.Get("/odata/v4/{entitySet}({id})/{navigation}/$ref", handleGetEntityRef)
+		r.Get("/odata/v4/{entitySet}/{id}/{navigation}/$ref", handleGetEntityRef)
+		r.Post("/odata/v4/{entitySet}({id})/{navigation}/$ref", handleCreateEntityRef)
+		r.Post("/odata/v4/{entitySet}/{id}/{navigation}/$ref", handleCreateEntityRef)
+		r.Put("/odata/v4/{entitySet}({id})/{navigation}/$ref", handleCreateEntityRef)
+		r.Put("/odata/v4/{entitySet}/{id}/{navigation}/$ref", handleCreateEntityRef)
+		r.Delete("/odata/v4/{entitySet}({id})/{navigation}/$ref", handleDeleteEntityRef)
+		r.Delete("/odata/v4/{entitySet}/{id}/{navigation}/$ref", handleDeleteEntityRef)
+		r.Delete("/odata/v4/{entitySet}({id})/{navigation}({targetID})/$ref", handleDeleteEntityRef)
+		r.Delete("/odata/v4/{entitySet}/{id}/{navigation}/{targetID}/$ref", handleDeleteEntityRef)
+	})
 	log.Println("Registered OData routes")
 }
\ No newline at end of file
@@ -0,0 +1,144 @@
+package odata
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+)
+
+// Multiplicities of the target of a relationship.
+const (
+	MultiplicityZeroOrOne = "0..1"
+	MultiplicityOne       = "1"
+	MultiplicityMany      = "*"
+)
+
+// OnDelete actions of a relationship, applied to the targets when the source
+// entity is deleted.
+const (
+	OnDeleteCascade    = "Cascade"
+	OnDeleteNone       = "None"
+	OnDeleteSetNull    = "SetNull"
+	OnDeleteSetDefault = "SetDefault"
+)
+
+// RelationshipOptions declares the details of a relationship that are
+// otherwise inferred. All of them are optional.
+type RelationshipOptions struct {
+	// Partner is the navigation property of the target leading back to the
+	// source, e.g. "Products" for Products.Category. Without it, the partner
+	// is the only relationship of the target pointing back at the source.
+	Partner string
+	// ForeignKey is the source property holding the key of the target.
+	// Without it, a <Name>_ID property is used if the source has one.
+	ForeignKey string
+	// ReferencedProperty is the target property ForeignKey refers to. It
+	// defaults to the key of the target.
+	ReferencedProperty string
+	// Multiplicity is MultiplicityZeroOrOne, MultiplicityOne or
+	// MultiplicityMany. It defaults to MultiplicityMany for one-to-many and
+	// many-to-many relationships and MultiplicityZeroOrOne otherwise. Only
+	// MultiplicityOne makes a single-valued navigation property non-nullable.
+	Multiplicity string
+	// OnDelete is one of the OnDelete actions.
+	OnDelete string
+}
+
+// RegisterEntityRelationshipWithOptions registers a relationship like
+// RegisterEntityRelationship with the details declared in options.
+func RegisterEntityRelationshipWithOptions(entityName, relationshipName, targetEntityName, relationType string, options RelationshipOptions) {
+	if err := options.validate(); err != nil {
+		log.Printf("Invalid options for relationship %s.%s: %v", entityName, relationshipName, err)
+	}
+	if entityRelationships[entityName] == nil {
+		entityRelationships[entityName] = make(map[string]RelationshipInfo)
+	}
+	entityRelationships[entityName][relationshipName] = RelationshipInfo{
+		TargetEntity:        targetEntityName,
+		Type:                relationType,
+		RelationshipOptions: options,
+	}
+	invalidateMetadata()
+	log.Printf("Registered relationship: %s.%s -> %s (%s)", entityName, relationshipName, targetEntityName, relationType)
+}
+
+func (o RelationshipOptions) validate() error {
+	var errs []error
+	switch o.Multiplicity {
+	case "", MultiplicityZeroOrOne, MultiplicityOne, MultiplicityMany:
+	default:
+		errs = append(errs, fmt.Errorf("unknown multiplicity %q", o.Multiplicity))
+	}
+	switch o.OnDelete {
+	case "", OnDeleteCascade, OnDeleteNone, OnDeleteSetNull, OnDeleteSetDefault:
+	default:
+		errs = append(errs, fmt.Errorf("unknown OnDelete action %q", o.OnDelete))
+	}
+	if o.Multiplicity == MultiplicityMany && o.ForeignKey != "" {
+		errs = append(errs, errors.New("a collection cannot have a foreign key"))
+	}
+	return errors.Join(errs...)
+}
+
+// relationshipPartner returns the navigation property of the target of
+// entitySet.relationshipName that leads back to entitySet: the declared
+// partner, or the only relationship of the target pointing at entitySet.
+func relationshipPartner(entitySet, relationshipName string) (string, bool) {
+	relInfo, ok := entityRelationships[entitySet][relationshipName]
+	if !ok {
+		return "", false
+	}
+	if relInfo.Partner != "" {
+		return relInfo.Partner, true
+	}
+
+	partner := ""
+	for partnerName, partnerInfo := range entityRelationships[relInfo.TargetEntity] {
+		if partnerInfo.TargetEntity != entitySet || (relInfo.TargetEntity == entitySet && partnerName == relationshipName) {
+			continue
+		}
+		if partner != "" {
+			// Ambiguous, e.g. Employees.Manager and Employees.Mentor
+			return "", false
+		}
+		partner = partnerName
+	}
+	return partner, partner != ""
+}
+
+// relationshipForeignKey returns the property of entitySet holding the key of
+// the target of entitySet.relationshipName.
+func relationshipForeignKey(entitySet, relationshipName string) (string, bool) {
+	relInfo, ok := entityRelationships[entitySet][relationshipName]
+	if !ok || relInfo.isCollection() {
+		return "", false
+	}
+	if relInfo.ForeignKey != "" {
+		return relInfo.ForeignKey, true
+	}
+
+	entityType, ok := lookupEntityType(entitySet)
+	if !ok {
+		return "", false
+	}
+	foreignKey := relationshipName + "_ID"
+	if _, ok := modelOf(reflect.TypeOf(entityType)).Property(foreignKey); ok {
+		return foreignKey, true
+	}
+	return "", false
+}
+
+// relationshipReferencedProperty returns the property of the target that the
+// foreign key of relInfo refers to: the declared one or the key of the
+// target. It reports false when neither is known, e.g. for a target with a
+// composite key.
+func relationshipReferencedProperty(relInfo RelationshipInfo) (string, bool) {
+	if relInfo.ReferencedProperty != "" {
+		return relInfo.ReferencedProperty, true
+	}
+	if targetKeys := entityKeyFields(relInfo.TargetEntity); len(targetKeys) == 1 {
+		return targetKeys[0], true
+	}
+	return "", false
+}
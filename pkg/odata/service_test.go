@@ -0,0 +1,61 @@
+package odata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceDocument(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## service_test - TestServiceDocument")
+	fmt.Println("")
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	metadataCustomizers = nil
+	defer func() { metadataCustomizers = nil }()
+	r := setupTestRouter()
+
+	RegisterMetadataCustomizer(func(edmx *Edmx) {
+		container := edmx.Schema("CatalogService").EntityContainer
+		container.Singletons = append(container.Singletons, &EdmSingleton{Name: "Me", Type: "CatalogService.Suppliers"})
+		container.FunctionImports = append(container.FunctionImports,
+			&EdmFunctionImport{Name: "TopProducts", Function: "CatalogService.TopProducts", EntitySet: "Products", IncludeInServiceDocument: true},
+			&EdmFunctionImport{Name: "Internal", Function: "CatalogService.Internal"},
+		)
+	})
+
+	get := func(url string) map[string]interface{} {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Host = "example.com"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response
+	}
+
+	response := get("/odata/v4/")
+	assert.Equal(t, "http://example.com/odata/v4/$metadata", response["@odata.context"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "Products", "kind": "EntitySet", "url": "Products"},
+		map[string]interface{}{"name": "Categories", "kind": "EntitySet", "url": "Categories"},
+		map[string]interface{}{"name": "Suppliers", "kind": "EntitySet", "url": "Suppliers"},
+		map[string]interface{}{"name": "Me", "kind": "Singleton", "url": "Me"},
+		map[string]interface{}{"name": "TopProducts", "kind": "FunctionImport", "url": "TopProducts"},
+	}, response["value"])
+
+	assert.Equal(t, response, get("/odata/v4"))
+
+	// The metadata document describes the same container
+	assert.Contains(t, GenerateMetadata(), `<Singleton Name="Me" Type="CatalogService.Suppliers"></Singleton>`)
+	assert.Contains(t, GenerateMetadata(), `<FunctionImport Name="TopProducts" Function="CatalogService.TopProducts" EntitySet="Products" IncludeInServiceDocument="true"></FunctionImport>`)
+}
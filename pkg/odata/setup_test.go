@@ -130,8 +130,78 @@ func (h TestProductHandler) ExpandEntity(entity OrderedFields, relationshipName
     return nil
 }
 
+func (h TestProductHandler) ReadEntity(id string) (interface{}, bool) {
+	for _, product := range testProducts {
+		if product.ID == id {
+			return product, true
+		}
+	}
+	return nil, false
+}
+
+func (h TestProductHandler) CreateLink(id, relationshipName, targetID string) error {
+	for i := range testProducts {
+		if testProducts[i].ID != id {
+			continue
+		}
+		switch relationshipName {
+		case "Category":
+			testProducts[i].Category_ID = targetID
+		case "Supplier":
+			testProducts[i].Supplier_ID = targetID
+		}
+		return nil
+	}
+	return ErrEntityNotFound
+}
+
+func (h TestProductHandler) CreateEntity(entity interface{}) (interface{}, error) {
+	product := entity.(TestProducts)
+	testProducts = append(testProducts, product)
+	return product, nil
+}
+
+func (h TestProductHandler) DeleteLink(id, relationshipName, targetID string) error {
+	return h.CreateLink(id, relationshipName, "")
+}
+
 type TestCategoryExpandHandler struct{}
 
+func (h TestCategoryExpandHandler) ReadEntity(id string) (interface{}, bool) {
+	for _, category := range testCategories {
+		if category.ID == id {
+			return category, true
+		}
+	}
+	return nil, false
+}
+
+func (h TestCategoryExpandHandler) CreateLink(id, relationshipName, targetID string) error {
+	for i := range testProducts {
+		if testProducts[i].ID == targetID {
+			testProducts[i].Category_ID = id
+			return nil
+		}
+	}
+	return ErrEntityNotFound
+}
+
+func (h TestCategoryExpandHandler) CreateEntity(entity interface{}) (interface{}, error) {
+	category := entity.(TestCategories)
+	testCategories = append(testCategories, category)
+	return category, nil
+}
+
+func (h TestCategoryExpandHandler) DeleteLink(id, relationshipName, targetID string) error {
+	for i := range testProducts {
+		if testProducts[i].ID == targetID && testProducts[i].Category_ID == id {
+			testProducts[i].Category_ID = ""
+			return nil
+		}
+	}
+	return ErrEntityNotFound
+}
+
 func (h TestCategoryExpandHandler) ExpandEntity(entity OrderedFields, relationshipName string, subQuery string) interface{} {
     var categoryID string
     for _, field := range entity.Fields {
@@ -183,7 +253,12 @@ func setupTestRouter() *chi.Mux {
 	productHandler := TestProductHandler{}
 	RegisterEntity(TestProducts{}, EntityHandler{
 		GetEntityHandler: func(w http.ResponseWriter, r *http.Request) {
-			result := ApplySkipTop(testProducts, r.URL.Query().Get("$skip"), r.URL.Query().Get("$top"))
+			filtered, err := ApplyFilter(testProducts, r.URL.RawQuery)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			result := ApplySkipTop(filtered, r.URL.Query().Get("$skip"), r.URL.Query().Get("$top"))
 			result = ApplyExpand(result, r.URL.RawQuery, productHandler)
 			result = ApplySelect(result, r.URL.RawQuery)
 			CreateODataResponse(w, "Products", result)
@@ -200,6 +275,9 @@ func setupTestRouter() *chi.Mux {
 			http.NotFound(w, r)
 		},
 		ExpandHandler: productHandler,
+		EntityReader:  productHandler,
+		LinkHandler:   productHandler,
+		EntityCreator: productHandler,
 	})
 
 	categoryHandler := TestCategoryExpandHandler{}
@@ -222,6 +300,9 @@ func setupTestRouter() *chi.Mux {
 			http.NotFound(w, r)
 		},
 		ExpandHandler: categoryHandler,
+		EntityReader:  categoryHandler,
+		LinkHandler:   categoryHandler,
+		EntityCreator: categoryHandler,
 	})
 
 	supplierHandler := TestSupplierExpandHandler{}
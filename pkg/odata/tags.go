@@ -0,0 +1,209 @@
+package odata
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fieldTag describes the odata struct tag of a field. The tag is a comma
+// separated list of options, either flags such as key or name:value pairs
+// such as maxlength:30, e.g. odata:"key,maxlength:10".
+type fieldTag struct {
+	Key     bool
+	NotNull bool
+	ETag    bool
+	// NoFilter, NoSort and NoExpand declare properties that cannot be used
+	// in $filter, $orderby and $expand. They are advertised as Capabilities
+	// restrictions. ApplyFilter rejects NoFilter properties, the routes
+	// registered by RegisterRoutes reject NoExpand properties in $expand and
+	// $expand=* skips them, while NoSort must be enforced by the handlers
+	NoFilter bool
+	NoSort   bool
+	NoExpand bool
+	// Name overrides the property name when the field has no json name
+	Name string
+	// Expand is the relationship a navigation property is expanded through
+	Expand string
+	// Ref is the entity set a foreign key property refers to
+	Ref       string
+	MaxLength string
+	Precision string
+	Scale     string
+}
+
+var fieldTagFlags = map[string]func(*fieldTag){
+	"key":      func(t *fieldTag) { t.Key = true },
+	"notnull":  func(t *fieldTag) { t.NotNull = true },
+	"etag":     func(t *fieldTag) { t.ETag = true },
+	"nofilter": func(t *fieldTag) { t.NoFilter = true },
+	"nosort":   func(t *fieldTag) { t.NoSort = true },
+	"noexpand": func(t *fieldTag) { t.NoExpand = true },
+}
+
+var fieldTagValues = map[string]func(*fieldTag, string) error{
+	"name":   func(t *fieldTag, v string) error { t.Name = v; return nil },
+	"expand": func(t *fieldTag, v string) error { t.Expand = v; return nil },
+	"ref":    func(t *fieldTag, v string) error { t.Ref = v; return nil },
+	"maxlength": func(t *fieldTag, v string) error {
+		t.MaxLength = v
+		if strings.EqualFold(v, "max") {
+			return nil
+		}
+		return checkFacet("maxlength", v, 1)
+	},
+	"precision": func(t *fieldTag, v string) error {
+		t.Precision = v
+		return checkFacet("precision", v, 1)
+	},
+	"scale": func(t *fieldTag, v string) error {
+		t.Scale = v
+		if v == "variable" || v == "floating" {
+			return nil
+		}
+		return checkFacet("scale", v, 0)
+	},
+}
+
+func checkFacet(option, value string, min int) error {
+	if n, err := strconv.Atoi(value); err != nil || n < min {
+		return fmt.Errorf("invalid %s %q", option, value)
+	}
+	return nil
+}
+
+// parseODataTag parses an odata struct tag. Unknown options, missing or
+// invalid values and repeated options are reported in the returned error;
+// the descriptor holds the options that could be parsed.
+func parseODataTag(tag string) (fieldTag, error) {
+	var t fieldTag
+	if tag == "" {
+		return t, nil
+	}
+
+	var errs []error
+	seen := make(map[string]bool)
+	for _, option := range strings.Split(tag, ",") {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(option), ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "" {
+			errs = append(errs, fmt.Errorf("empty option"))
+			continue
+		}
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("repeated option %s", name))
+			continue
+		}
+		seen[name] = true
+
+		if set, ok := fieldTagFlags[name]; ok {
+			if hasValue {
+				errs = append(errs, fmt.Errorf("option %s takes no value", name))
+				continue
+			}
+			set(&t)
+		} else if set, ok := fieldTagValues[name]; ok {
+			if value == "" {
+				errs = append(errs, fmt.Errorf("option %s requires a value", name))
+				continue
+			}
+			if err := set(&t, value); err != nil {
+				errs = append(errs, err)
+			}
+		} else {
+			errs = append(errs, fmt.Errorf("unknown option %s", name))
+		}
+	}
+	return t, errors.Join(errs...)
+}
+
+var fieldTagCache sync.Map
+
+// fieldTags returns the parsed odata tag of field. Tags are parsed once and
+// cached; invalid options are ignored here and reported by
+// ValidateEntityTags.
+func fieldTags(field reflect.StructField) fieldTag {
+	tag := field.Tag.Get("odata")
+	if cached, ok := fieldTagCache.Load(tag); ok {
+		return cached.(fieldTag)
+	}
+	t, _ := parseODataTag(tag)
+	fieldTagCache.Store(tag, t)
+	return t
+}
+
+// ValidateEntityTags checks the odata tags of the fields of entity for
+// unknown options, invalid values and options that conflict with each other
+// or with the field type. RegisterEntity panics with the errors it reports.
+func ValidateEntityTags(entity Entity) error {
+	typ := reflect.TypeOf(entity)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return fmt.Errorf("%s: entity type %s is not a struct", entity.EntityName(), typ)
+	}
+
+	var errs []error
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if _, ok := field.Tag.Lookup("odata"); !ok {
+			continue
+		}
+		for _, err := range fieldTagErrors(field) {
+			errs = append(errs, fmt.Errorf("%s.%s: %w", entity.EntityName(), field.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func fieldTagErrors(field reflect.StructField) []error {
+	t, err := parseODataTag(field.Tag.Get("odata"))
+	var errs []error
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid odata tag %q: %w", field.Tag.Get("odata"), err))
+	}
+
+	if !isProperty(field) && (t.Key || t.ETag || t.Expand != "") {
+		errs = append(errs, fmt.Errorf("hidden field cannot be a key, an etag or a navigation property"))
+	}
+	if t.Expand != "" {
+		if !isNavigationProperty(field) {
+			errs = append(errs, fmt.Errorf("expand requires a pointer or slice field, got %s", field.Type))
+		}
+		if t.Key || t.ETag || t.NotNull || t.Ref != "" || t.MaxLength != "" || t.Precision != "" || t.Scale != "" {
+			errs = append(errs, fmt.Errorf("expand cannot be combined with structural property options"))
+		}
+		if t.Name != "" && t.Name != t.Expand {
+			errs = append(errs, fmt.Errorf("navigation property is named %s by expand, not %s", t.Expand, t.Name))
+		}
+		return errs
+	}
+
+	if t.NoExpand {
+		errs = append(errs, fmt.Errorf("noexpand requires a navigation property"))
+	}
+	if t.MaxLength != "" && field.Type.Kind() != reflect.String {
+		errs = append(errs, fmt.Errorf("maxlength requires a string field, got %s", field.Type))
+	}
+	if t.Precision != "" || t.Scale != "" {
+		switch field.Type.Kind() {
+		case reflect.Float32, reflect.Float64:
+		default:
+			errs = append(errs, fmt.Errorf("precision and scale require a decimal field, got %s", field.Type))
+		}
+	}
+	if precision, err := strconv.Atoi(t.Precision); err == nil {
+		if scale, err := strconv.Atoi(t.Scale); err == nil && scale > precision {
+			errs = append(errs, fmt.Errorf("scale %d exceeds precision %d", scale, precision))
+		}
+	}
+	if t.Key && isNullable(field.Type) {
+		errs = append(errs, fmt.Errorf("key requires a non-nullable field, got %s", field.Type))
+	}
+	return errs
+}
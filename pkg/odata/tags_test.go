@@ -0,0 +1,89 @@
+package odata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseODataTag(t *testing.T) {
+	tag, err := parseODataTag("key, maxlength:10,notnull")
+	assert.NoError(t, err)
+	assert.Equal(t, fieldTag{Key: true, NotNull: true, MaxLength: "10"}, tag)
+
+	tag, err = parseODataTag("precision:9,scale:2")
+	assert.NoError(t, err)
+	assert.Equal(t, fieldTag{Precision: "9", Scale: "2"}, tag)
+
+	// Options are matched exactly, not by substring
+	tag, err = parseODataTag("keyword,notnullable")
+	assert.EqualError(t, err, "unknown option keyword\nunknown option notnullable")
+	assert.Equal(t, fieldTag{}, tag)
+
+	for _, invalid := range []string{"key:1", "expand", "expand:", "maxlength:0", "maxlength:ten", "scale:-1", "key,key", "key,"} {
+		_, err := parseODataTag(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+type TestTaggedOrders struct {
+	ID       string            `json:"ID" odata:"key"`
+	Customer string            `json:"Customer" odata:"notnull,maxlength:40"`
+	Total    float64           `json:"Total" odata:"precision:9,scale:2"`
+	Items    []TestTaggedItems `json:"Items,omitempty" odata:"expand:Items"`
+}
+
+func (o TestTaggedOrders) EntityName() string {
+	return "TaggedOrders"
+}
+
+func (o TestTaggedOrders) GetRelationships() map[string]string {
+	return map[string]string{"Items": "TaggedItems"}
+}
+
+type TestTaggedItems struct {
+	ID       string            `json:"ID" odata:"keyword"`
+	Name     string            `json:"Name" odata:"maxlength:40,maxlength:50"`
+	Quantity int               `json:"Quantity" odata:"maxlength:10,precision:2,scale:3"`
+	Order    TestTaggedOrders  `json:"Order" odata:"expand:Order"`
+	Parent   *TestTaggedOrders `json:"Parent" odata:"key,expand:Parent"`
+}
+
+func (i TestTaggedItems) EntityName() string {
+	return "TaggedItems"
+}
+
+func (i TestTaggedItems) GetRelationships() map[string]string {
+	return map[string]string{}
+}
+
+func TestValidateEntityTags(t *testing.T) {
+	assert.NoError(t, ValidateEntityTags(TestTaggedOrders{}))
+
+	err := ValidateEntityTags(TestTaggedItems{})
+	assert.EqualError(t, err, `TaggedItems.ID: invalid odata tag "keyword": unknown option keyword
+TaggedItems.Name: invalid odata tag "maxlength:40,maxlength:50": repeated option maxlength
+TaggedItems.Quantity: maxlength requires a string field, got int
+TaggedItems.Quantity: precision and scale require a decimal field, got int
+TaggedItems.Quantity: scale 3 exceeds precision 2
+TaggedItems.Order: expand requires a pointer or slice field, got odata.TestTaggedOrders
+TaggedItems.Parent: expand cannot be combined with structural property options`)
+
+	assert.PanicsWithValue(t, "odata: invalid tags on entity TaggedItems: "+err.Error(), func() {
+		RegisterEntity(TestTaggedItems{}, EntityHandler{})
+	})
+	_, registered := GetEntityHandler("TaggedItems")
+	assert.False(t, registered)
+}
+
+func TestCombinedTags(t *testing.T) {
+	typ := reflect.TypeOf(TestTaggedItems{})
+	parent, _ := typ.FieldByName("Parent")
+	assert.Equal(t, "Parent", fieldTags(parent).Expand)
+	assert.True(t, fieldTags(parent).Key)
+
+	// Fields whose tag merely contains "key" are not keys
+	id, _ := typ.FieldByName("ID")
+	assert.False(t, fieldTags(id).Key)
+}
@@ -2,6 +2,7 @@ package odata
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"reflect"
@@ -30,21 +31,37 @@ func EntityToOrderedFields(entity interface{}, expand string) OrderedFields {
 		typ := val.Type()
 		result.Fields = make([]struct{Key string; Value interface{}}, 0, val.NumField())
 
-		for i := 0; i < val.NumField(); i++ {
-			field := typ.Field(i)
-			fieldValue := val.Field(i)
+		for _, property := range modelOf(typ).Properties {
+			fieldValue := property.Value(val)
+			name := property.Name
 			
 			// Check if the field is expandable
-			odataTag := field.Tag.Get("odata")
-			if strings.HasPrefix(odataTag, "expand:") {
-				expandField := strings.TrimPrefix(odataTag, "expand:")
+			if expandField := property.tags.Expand; expandField != "" {
 				if expand == "" || !containsField(expand, expandField) {
 					continue // Skip this field if it's not expanded
 				}
 			}
 			
-			result.Fields = append(result.Fields, struct{Key string; Value interface{}}{field.Name, fieldValue.Interface()})
+			// Stream properties are represented by a link to their content,
+			// completed by addMediaLinks once the entity's key is known
+			if property.Stream {
+				result.Fields = append(result.Fields, struct{Key string; Value interface{}}{name + "@odata.mediaReadLink", ""})
+				if contentType := fieldValue.Interface().(Stream).ContentType; contentType != "" {
+					result.Fields = append(result.Fields, struct{Key string; Value interface{}}{name + "@odata.mediaContentType", contentType})
+				}
+				continue
+			}
+
+			result.Fields = append(result.Fields, struct{Key string; Value interface{}}{name, fieldValue.Interface()})
 		}
+		addMediaLinks(&result, entity)
+
+		// Emit the ETag as control information ahead of the properties
+		if etag := entityETag(entity); etag != "" {
+			etagField := struct{Key string; Value interface{}}{"@odata.etag", etag}
+			result.Fields = append([]struct{Key string; Value interface{}}{etagField}, result.Fields...)
+		}
+		result = addInstanceAnnotations(result, entity)
 
 	case reflect.Map:
 		keys := val.MapKeys()
@@ -114,15 +131,31 @@ func CreateODataResponse(w http.ResponseWriter, entitySet string, entities inter
 
 	response := OrderedFields{
 		Fields: []struct{Key string; Value interface{}}{
-			{Key: "@odata.context", Value: "$metadata#" + entitySet},
+			{Key: "@odata.context", Value: entitySetContextURL(w, entitySet, "")},
 			{Key: "value", Value: orderedEntities},
 		},
 	}
+	if pw := responsePreferences(w); pw != nil && pw.deltaLink != "" {
+		response.Fields = append(response.Fields, struct{Key string; Value interface{}}{"@odata.deltaLink", pw.deltaLink})
+	}
 	encodeJSONPreserveOrder(w, response)
 }
 
 // Helper function to create OData response for a single entity
 func CreateODataResponseSingle(w http.ResponseWriter, entitySet string, entity interface{}) {
+	writeODataResponseSingle(w, entitySet, entity, http.StatusOK)
+}
+
+// Helper function to create OData response for a newly created entity. The
+// Location header points at the entity relative to its entity set.
+func CreateODataResponseCreated(w http.ResponseWriter, entitySet string, entity interface{}) {
+	if location := entityReference(toOrderedFields(entity, "")); location != "" {
+		w.Header().Set("Location", location)
+	}
+	writeODataResponseSingle(w, entitySet, entity, http.StatusCreated)
+}
+
+func writeODataResponseSingle(w http.ResponseWriter, entitySet string, entity interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("OData-Version", "4.0")
 
@@ -152,15 +185,51 @@ func CreateODataResponseSingle(w http.ResponseWriter, entitySet string, entity i
 		orderedEntity = EntityToOrderedFields(entity, "")
 	}
 
+	for _, field := range orderedEntity.Fields {
+		if field.Key == "@odata.etag" {
+			w.Header().Set("ETag", fmt.Sprint(field.Value))
+		}
+	}
+
+	if (status == http.StatusOK || status == http.StatusCreated) && preferMinimal(w) {
+		if entityID := entityReference(orderedEntity); entityID != "" {
+			w.Header().Set("OData-EntityId", entityID)
+		}
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	// Add @odata.context to the beginning of the OrderedFields
-	contextField := struct{Key string; Value interface{}}{"@odata.context", "$metadata#" + entitySet + "/$entity"}
+	contextField := struct{Key string; Value interface{}}{"@odata.context", entitySetContextURL(w, entitySet, "/$entity")}
 	orderedEntity.Fields = append([]struct{Key string; Value interface{}}{contextField}, orderedEntity.Fields...)
 
+	w.WriteHeader(status)
 	encodeJSONPreserveOrder(w, orderedEntity)
 }
 
-// Helper function to encode JSON while preserving field order
+// CreateODataValueResponse writes a single value, such as a property or the
+// result of an operation, with the context URL fragment that describes it,
+// e.g. "Products('1')/Name" or "Collection(Edm.String)".
+func CreateODataValueResponse(w http.ResponseWriter, context string, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("OData-Version", "4.0")
+
+	response := OrderedFields{
+		Fields: []struct{Key string; Value interface{}}{
+			{Key: "@odata.context", Value: contextURL(w, context)},
+			{Key: "value", Value: value},
+		},
+	}
+	encodeJSONPreserveOrder(w, response)
+}
+
+// Helper function to encode JSON while preserving field order. Instance
+// annotations not requested through odata.include-annotations are dropped
+// and control information follows the requested odata.metadata level.
 func encodeJSONPreserveOrder(w http.ResponseWriter, v interface{}) error {
+	v = filterInstanceAnnotations(w, v)
+	v = applyMetadataLevel(w, v)
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 	encoder.SetEscapeHTML(false)
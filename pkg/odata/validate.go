@@ -0,0 +1,107 @@
+package odata
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// relationshipTypes are the relation types RegisterEntityRelationship
+// accepts.
+var relationshipTypes = map[string]bool{
+	"one-to-one":   true,
+	"one-to-many":  true,
+	"many-to-one":  true,
+	"many-to-many": true,
+}
+
+// Validate checks the registered entities and relationships for mistakes the
+// registration functions accept: duplicate entity names, entities without a
+// key, relationships of unknown entities or with unknown types, and
+// relationships without a matching navigation property. Invalid odata tags
+// are already rejected by RegisterEntity. All
+// problems are reported in one error. Call it after registering everything,
+// e.g. before RegisterRoutes.
+func Validate() error {
+	var errs []error
+	registered := make(map[string]bool)
+	for _, entityType := range entityTypes {
+		name := entityType.EntityName()
+		if registered[name] {
+			errs = append(errs, fmt.Errorf("entity %s is registered more than once", name))
+			continue
+		}
+		registered[name] = true
+
+		if len(modelOf(reflect.TypeOf(entityType)).Keys) == 0 {
+			errs = append(errs, fmt.Errorf("entity %s has no key property", name))
+		}
+	}
+
+	entityNames := make([]string, 0, len(entityRelationships))
+	for entityName := range entityRelationships {
+		entityNames = append(entityNames, entityName)
+	}
+	sort.Strings(entityNames)
+	for _, entityName := range entityNames {
+		relationshipNames := make([]string, 0, len(entityRelationships[entityName]))
+		for relationshipName := range entityRelationships[entityName] {
+			relationshipNames = append(relationshipNames, relationshipName)
+		}
+		sort.Strings(relationshipNames)
+		for _, relationshipName := range relationshipNames {
+			for _, err := range relationshipErrors(entityName, relationshipName) {
+				errs = append(errs, fmt.Errorf("relationship %s.%s: %w", entityName, relationshipName, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func relationshipErrors(entityName, relationshipName string) []error {
+	relInfo := entityRelationships[entityName][relationshipName]
+	var errs []error
+	if !relationshipTypes[relInfo.Type] {
+		errs = append(errs, fmt.Errorf("unknown relationship type %q", relInfo.Type))
+	}
+	if err := relInfo.RelationshipOptions.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if targetType, ok := lookupEntityType(relInfo.TargetEntity); !ok {
+		errs = append(errs, fmt.Errorf("target entity %s is not registered", relInfo.TargetEntity))
+	} else {
+		if relInfo.Partner != "" {
+			if _, ok := entityRelationships[relInfo.TargetEntity][relInfo.Partner]; !ok {
+				errs = append(errs, fmt.Errorf("partner %s.%s is not registered", relInfo.TargetEntity, relInfo.Partner))
+			}
+		}
+		if relInfo.ReferencedProperty != "" {
+			if _, ok := modelOf(reflect.TypeOf(targetType)).Property(relInfo.ReferencedProperty); !ok {
+				errs = append(errs, fmt.Errorf("referenced property %s is not a property of %s", relInfo.ReferencedProperty, relInfo.TargetEntity))
+			}
+		} else if _, ok := relationshipForeignKey(entityName, relationshipName); ok {
+			if _, ok := relationshipReferencedProperty(relInfo); !ok {
+				errs = append(errs, fmt.Errorf("%s has no single key for the foreign key to refer to; set ReferencedProperty", relInfo.TargetEntity))
+			}
+		}
+	}
+
+	entityType, ok := lookupEntityType(entityName)
+	if !ok {
+		return append(errs, fmt.Errorf("entity %s is not registered", entityName))
+	}
+	model := modelOf(reflect.TypeOf(entityType))
+	property, ok := model.Property(relationshipName)
+	if !ok || !property.Navigation {
+		errs = append(errs, fmt.Errorf("%s has no navigation property %s", entityName, relationshipName))
+	} else if isCollection := property.Field.Type.Kind() == reflect.Slice; isCollection != relInfo.isCollection() {
+		errs = append(errs, fmt.Errorf("navigation property %s is %s, which does not match the relationship", relationshipName, property.Field.Type))
+	}
+	if relInfo.ForeignKey != "" {
+		if _, ok := model.Property(relInfo.ForeignKey); !ok {
+			errs = append(errs, fmt.Errorf("foreign key %s is not a property of %s", relInfo.ForeignKey, entityName))
+		}
+	}
+	return errs
+}
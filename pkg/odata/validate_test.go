@@ -0,0 +1,64 @@
+package odata
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestUnkeyedNotes struct {
+	Text  string           `json:"Text"`
+	Owner *TestSuppliers   `json:"Owner,omitempty" odata:"expand:Owner"`
+	Tags  []TestCategories `json:"Tags,omitempty" odata:"expand:Tags"`
+}
+
+func (n TestUnkeyedNotes) EntityName() string {
+	return "UnkeyedNotes"
+}
+
+func (n TestUnkeyedNotes) GetRelationships() map[string]string {
+	return map[string]string{}
+}
+
+func TestValidate(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## validate_test - TestValidate")
+	fmt.Println("")
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	setupTestRouter()
+	assert.NoError(t, Validate())
+
+	RegisterEntity(TestUnkeyedNotes{}, EntityHandler{})
+	RegisterEntity(TestCategories{}, EntityHandler{})
+	RegisterEntityRelationship("UnkeyedNotes", "Owner", "Suppliers", "one-to-many")
+	RegisterEntityRelationship("UnkeyedNotes", "Tags", "Categories", "one-too-many")
+	RegisterEntityRelationship("UnkeyedNotes", "Author", "Authors", "one-to-one")
+	RegisterEntityRelationship("Drafts", "Notes", "UnkeyedNotes", "one-to-many")
+	RegisterEntityRelationshipWithOptions("Products", "Category", "Categories", "one-to-one", RelationshipOptions{
+		Partner:            "Items",
+		ForeignKey:         "CategoryID",
+		ReferencedProperty: "Code",
+		OnDelete:           "Remove",
+	})
+	RegisterEntityRelationship("Products", "Supplier", "UnkeyedNotes", "many-to-one")
+
+	assert.EqualError(t, Validate(), `entity UnkeyedNotes has no key property
+entity Categories is registered more than once
+relationship Drafts.Notes: entity Drafts is not registered
+relationship Products.Category: unknown OnDelete action "Remove"
+relationship Products.Category: partner Categories.Items is not registered
+relationship Products.Category: referenced property Code is not a property of Categories
+relationship Products.Category: foreign key CategoryID is not a property of Products
+relationship Products.Supplier: UnkeyedNotes has no single key for the foreign key to refer to; set ReferencedProperty
+relationship UnkeyedNotes.Author: target entity Authors is not registered
+relationship UnkeyedNotes.Author: UnkeyedNotes has no navigation property Author
+relationship UnkeyedNotes.Owner: navigation property Owner is *odata.TestSuppliers, which does not match the relationship
+relationship UnkeyedNotes.Tags: unknown relationship type "one-too-many"
+relationship UnkeyedNotes.Tags: navigation property Tags is []odata.TestCategories, which does not match the relationship`)
+
+	supplier, _ := modelOf(reflect.TypeOf(TestProducts{})).Property("Supplier")
+	assert.Empty(t, buildNavigationProperty(supplier, "Products").ReferentialConstraints)
+}
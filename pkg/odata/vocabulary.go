@@ -0,0 +1,154 @@
+package odata
+
+import "strings"
+
+// vocabularyAnnotations are the annotations registered with
+// RegisterAnnotations, in registration order.
+var vocabularyAnnotations []*EdmAnnotations
+
+// RegisterAnnotations attaches vocabulary annotations to the model element
+// target. Targets are relative to the service schema: "Products" for an entity
+// type, "Products/Name" for a property or navigation property, and
+// "EntityContainer/Products" for an entity set, singleton or function import.
+// They are emitted in an Annotations element of the metadata document:
+//
+//	RegisterAnnotations("Products/Name", CommonLabel("Product Name"), CoreDescription("Name shown to customers"))
+//	RegisterAnnotations("Products", UILineItem(UIDataField("Name", ""), UIDataField("Price", "Price")))
+func RegisterAnnotations(target string, annotations ...*EdmAnnotation) {
+	if !strings.HasPrefix(target, schemaNamespace+".") {
+		target = schemaNamespace + "." + target
+	}
+	for _, targeted := range vocabularyAnnotations {
+		if targeted.Target == target {
+			targeted.Annotations = append(targeted.Annotations, annotations...)
+			invalidateMetadata()
+			return
+		}
+	}
+	vocabularyAnnotations = append(vocabularyAnnotations, &EdmAnnotations{Target: target, Annotations: annotations})
+	invalidateMetadata()
+}
+
+// buildVocabularyAnnotations returns a copy of the registered annotations, so
+// that metadata customizers cannot change the registry.
+func buildVocabularyAnnotations() []*EdmAnnotations {
+	result := make([]*EdmAnnotations, 0, len(vocabularyAnnotations))
+	for _, targeted := range vocabularyAnnotations {
+		result = append(result, &EdmAnnotations{
+			Target:      targeted.Target,
+			Annotations: append([]*EdmAnnotation(nil), targeted.Annotations...),
+		})
+	}
+	return result
+}
+
+// registeredAnnotation returns the unqualified annotation with term that was
+// registered for target, a target relative to the service schema like in
+// RegisterAnnotations.
+func registeredAnnotation(target, term string) *EdmAnnotation {
+	for _, targeted := range vocabularyAnnotations {
+		if targeted.Target != schemaNamespace+"."+target {
+			continue
+		}
+		for _, annotation := range targeted.Annotations {
+			if annotation.Term == term && annotation.Qualifier == "" {
+				return annotation
+			}
+		}
+	}
+	return nil
+}
+
+// CoreDescription describes the annotated element.
+func CoreDescription(description string) *EdmAnnotation {
+	return &EdmAnnotation{Term: "Core.Description", EdmExpression: EdmExpression{String: description}}
+}
+
+// CoreComputed marks a property whose value is computed by the service and
+// cannot be changed by clients.
+func CoreComputed() *EdmAnnotation {
+	return &EdmAnnotation{Term: "Core.Computed", EdmExpression: EdmExpression{Bool: "true"}}
+}
+
+// CoreImmutable marks a property that can be set on insert but not changed
+// afterwards.
+func CoreImmutable() *EdmAnnotation {
+	return &EdmAnnotation{Term: "Core.Immutable", EdmExpression: EdmExpression{Bool: "true"}}
+}
+
+// CommonLabel is the label shown for the annotated element.
+func CommonLabel(label string) *EdmAnnotation {
+	return &EdmAnnotation{Term: "Common.Label", EdmExpression: EdmExpression{String: label}}
+}
+
+// CommonText names the property holding the descriptive text of the
+// annotated property, e.g. Category/Name for Category_ID.
+func CommonText(path string) *EdmAnnotation {
+	return &EdmAnnotation{Term: "Common.Text", EdmExpression: EdmExpression{Path: path}}
+}
+
+// CapabilitiesFilterRestrictions describes whether an entity set can be
+// filtered and which of its properties cannot be used in $filter.
+func CapabilitiesFilterRestrictions(filterable bool, nonFilterableProperties ...string) *EdmAnnotation {
+	return capabilityRestrictions("Capabilities.FilterRestrictions", "Filterable", filterable, "NonFilterableProperties", &EdmCollection{PropertyPaths: nonFilterableProperties})
+}
+
+// capabilityRestrictions returns the restrictions term with a record of the
+// Boolean property and the collection listProperty, left out when empty.
+func capabilityRestrictions(term, property string, value bool, listProperty string, list *EdmCollection) *EdmAnnotation {
+	record := &EdmRecord{PropertyValues: []*EdmPropertyValue{
+		{Property: property, EdmExpression: edmBool(value)},
+	}}
+	if list != nil && (len(list.PropertyPaths) > 0 || len(list.NavigationPropertyPaths) > 0) {
+		record.PropertyValues = append(record.PropertyValues, &EdmPropertyValue{
+			Property:      listProperty,
+			EdmExpression: EdmExpression{Collection: list},
+		})
+	}
+	return &EdmAnnotation{Term: term, EdmExpression: EdmExpression{Record: record}}
+}
+
+// UILineItem lists the columns of the annotated entity type in a table.
+func UILineItem(fields ...*EdmRecord) *EdmAnnotation {
+	return &EdmAnnotation{Term: "UI.LineItem", EdmExpression: EdmExpression{Collection: &EdmCollection{Records: fields}}}
+}
+
+// UISelectionFields lists the properties offered as filter fields.
+func UISelectionFields(paths ...string) *EdmAnnotation {
+	return &EdmAnnotation{Term: "UI.SelectionFields", EdmExpression: EdmExpression{Collection: &EdmCollection{PropertyPaths: paths}}}
+}
+
+// UIHeaderInfo describes how an entity is titled on its object page.
+func UIHeaderInfo(typeName, typeNamePlural, titlePath string) *EdmAnnotation {
+	return &EdmAnnotation{Term: "UI.HeaderInfo", EdmExpression: EdmExpression{Record: &EdmRecord{
+		Type: "UI.HeaderInfoType",
+		PropertyValues: []*EdmPropertyValue{
+			{Property: "TypeName", EdmExpression: EdmExpression{String: typeName}},
+			{Property: "TypeNamePlural", EdmExpression: EdmExpression{String: typeNamePlural}},
+			{Property: "Title", EdmExpression: EdmExpression{Record: &EdmRecord{
+				Type:           "UI.DataField",
+				PropertyValues: []*EdmPropertyValue{{Property: "Value", EdmExpression: EdmExpression{Path: titlePath}}},
+			}}},
+		},
+	}}}
+}
+
+// UIDataField is a UI.LineItem column showing the property at path, labeled
+// with label unless it is empty.
+func UIDataField(path, label string) *EdmRecord {
+	record := &EdmRecord{
+		Type:           "UI.DataField",
+		PropertyValues: []*EdmPropertyValue{{Property: "Value", EdmExpression: EdmExpression{Path: path}}},
+	}
+	if label != "" {
+		record.PropertyValues = append(record.PropertyValues, &EdmPropertyValue{Property: "Label", EdmExpression: EdmExpression{String: label}})
+	}
+	return record
+}
+
+func edmBool(value bool) EdmExpression {
+	if value {
+		return EdmExpression{Bool: "true"}
+	}
+	return EdmExpression{Bool: "false"}
+}
@@ -0,0 +1,116 @@
+package odata
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVocabularyAnnotations(t *testing.T) {
+	fmt.Println("")
+	fmt.Println("########## vocabulary_test - TestVocabularyAnnotations")
+	fmt.Println("")
+	entityTypes = []Entity{}
+	entityRelationships = make(map[string]map[string]RelationshipInfo)
+	vocabularyAnnotations = nil
+	defer func() { vocabularyAnnotations = nil }()
+	setupTestRouter()
+
+	RegisterAnnotations("Products/Name", CommonLabel("Product Name"), CoreDescription("Name shown to customers"))
+	RegisterAnnotations("Products/Category_ID", CommonText("Category/Name"))
+	RegisterAnnotations("Products",
+		UIHeaderInfo("Product", "Products", "Name"),
+		UILineItem(UIDataField("Name", ""), UIDataField("Price", "Price")),
+		UISelectionFields("Name", "Category_ID"),
+	)
+	RegisterAnnotations("CatalogService.EntityContainer/Products", CapabilitiesFilterRestrictions(true, "Description"))
+	RegisterAnnotations("Products/ID", CoreComputed())
+	RegisterAnnotations("Products/Name", CoreImmutable())
+
+	schema := BuildMetadata().Schema("CatalogService")
+	assert.Len(t, schema.Annotations, 5)
+	assert.Equal(t, "CatalogService.Products/Name", schema.Annotations[0].Target)
+	assert.Equal(t, []string{"Common.Label", "Core.Description", "Core.Immutable"}, annotationTerms(schema.Annotations[0].Annotations))
+	assert.Equal(t, "CatalogService.EntityContainer/Products", schema.Annotations[3].Target)
+
+	// Customizers work on a copy of the registered annotations
+	RegisterMetadataCustomizer(func(edmx *Edmx) {
+		annotations := edmx.Schema("CatalogService").Annotations
+		annotations[0].Annotations = annotations[0].Annotations[:1]
+	})
+	defer func() { metadataCustomizers = nil }()
+	BuildMetadata()
+	assert.Len(t, vocabularyAnnotations[0].Annotations, 3)
+	metadataCustomizers = nil
+	invalidateMetadata()
+
+	metadata := GenerateMetadata()
+	var edmx struct {
+		References []struct {
+			URI string `xml:"Uri,attr"`
+		} `xml:"Reference"`
+		DataServices struct {
+			Schema struct {
+				Annotations []struct {
+					Target      string `xml:"Target,attr"`
+					Annotations []struct {
+						Term   string `xml:"Term,attr"`
+						String string `xml:"String,attr"`
+						Path   string `xml:"Path,attr"`
+						Record struct {
+							PropertyValues []struct {
+								Property string `xml:"Property,attr"`
+								Bool     string `xml:"Bool,attr"`
+							} `xml:"PropertyValue"`
+						} `xml:"Record"`
+						Collection struct {
+							Records []struct {
+								Type string `xml:"Type,attr"`
+							} `xml:"Record"`
+						} `xml:"Collection"`
+					} `xml:"Annotation"`
+				} `xml:"Annotations"`
+			} `xml:"Schema"`
+		} `xml:"DataServices"`
+	}
+	err := xml.Unmarshal([]byte(metadata), &edmx)
+	assert.NoError(t, err)
+	var references []string
+	for _, reference := range edmx.References {
+		references = append(references, reference.URI)
+	}
+	assert.Contains(t, references, "https://sap.github.io/odata-vocabularies/vocabularies/UI.xml")
+	assert.Contains(t, references, "https://oasis-tcs.github.io/odata-vocabularies/vocabularies/Org.OData.Capabilities.V1.xml")
+
+	annotations := edmx.DataServices.Schema.Annotations
+	assert.Equal(t, "Product Name", annotations[0].Annotations[0].String)
+	assert.Equal(t, "Category/Name", annotations[1].Annotations[0].Path)
+	assert.Equal(t, "UI.DataField", annotations[2].Annotations[1].Collection.Records[1].Type)
+	assert.Equal(t, "Filterable", annotations[3].Annotations[0].Record.PropertyValues[0].Property)
+	assert.Equal(t, "true", annotations[3].Annotations[0].Record.PropertyValues[0].Bool)
+
+	var csdl struct {
+		CatalogService struct {
+			Annotations map[string]map[string]interface{} `json:"$Annotations"`
+		}
+	}
+	err = json.Unmarshal([]byte(GenerateMetadataJSON()), &csdl)
+	assert.NoError(t, err)
+	assert.Equal(t, "Product Name", csdl.CatalogService.Annotations["CatalogService.Products/Name"]["@Common.Label"])
+	assert.Equal(t, map[string]interface{}{
+		"Filterable":              true,
+		"NonFilterableProperties": []interface{}{map[string]interface{}{"$PropertyPath": "Description"}},
+	}, csdl.CatalogService.Annotations["CatalogService.EntityContainer/Products"]["@Capabilities.FilterRestrictions"])
+	assert.Equal(t, true, csdl.CatalogService.Annotations["CatalogService.Products/ID"]["@Core.Computed"])
+}
+
+func annotationTerms(annotations []*EdmAnnotation) []string {
+	terms := make([]string, len(annotations))
+	for i, annotation := range annotations {
+		terms[i] = annotation.Term
+	}
+	return terms
+}